@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errAccountingDisabled is returned when no GPU has accounting mode on
+// (enable it with `nvidia-smi --accounting-mode=1`).
+var errAccountingDisabled = errors.New("accounting mode is disabled on all GPUs")
+
+type AccountedProcess struct {
+	GPUUUID           string `json:"gpu_uuid"`
+	PID               int    `json:"pid"`
+	MaxMemoryUsageMiB int    `json:"max_memory_usage_mib"`
+	GPUUtilizationPct int    `json:"gpu_utilization_pct"`
+	MemUtilizationPct int    `json:"mem_utilization_pct"`
+	TimeMs            int    `json:"time_ms"`
+	IsRunning         bool   `json:"is_running"`
+}
+
+type AccountingStats struct {
+	Timestamp string             `json:"timestamp"`
+	Processes []AccountedProcess `json:"processes"`
+}
+
+// Accounting queries the driver's per-process accounting records, which
+// outlive the processes themselves.
+func (m *GPUMonitor) Accounting() (*AccountingStats, error) {
+	stats := &AccountingStats{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Processes: []AccountedProcess{},
+	}
+	if m.mock {
+		return stats, nil
+	}
+
+	modes, err := m.smi.run("--query-gpu=accounting.mode", "--format=csv,noheader")
+	if err != nil {
+		return nil, fmt.Errorf("query accounting.mode: %w", err)
+	}
+	if !strings.Contains(string(modes), "Enabled") {
+		return nil, errAccountingDisabled
+	}
+
+	out, err := m.smi.run(
+		"--query-accounted-apps=gpu_uuid,pid,max_memory_usage,gpu_utilization,mem_utilization,time,is_running",
+		"--format=csv,noheader,nounits",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query-accounted-apps: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ", ")
+		if len(fields) < 7 {
+			continue
+		}
+		stats.Processes = append(stats.Processes, AccountedProcess{
+			GPUUUID:           fields[0],
+			PID:               parseInt(fields[1]),
+			MaxMemoryUsageMiB: parseInt(fields[2]),
+			GPUUtilizationPct: parseInt(fields[3]),
+			MemUtilizationPct: parseInt(fields[4]),
+			TimeMs:            parseInt(fields[5]),
+			IsRunning:         fields[6] == "1" || fields[6] == "Yes",
+		})
+	}
+	return stats, nil
+}
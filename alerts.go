@@ -0,0 +1,119 @@
+package main
+
+import "log"
+
+// Alert levels, in increasing severity.
+const (
+	alertNormal = iota
+	alertWarning
+	alertCritical
+)
+
+var alertLevelNames = []string{"normal", "warning", "critical"}
+
+// alertRule has the warning and critical entry levels of one GPU metric. A
+// level is left only once the value drops hysteresis below its entry
+// level, so a value hovering at a threshold doesn't flap.
+type alertRule struct {
+	name       string
+	warn, crit float64
+	hysteresis float64
+	value      func(g *GPUInfo) float64
+}
+
+// level returns the new level of a metric currently at cur.
+func (r *alertRule) level(cur int, v float64) int {
+	next := alertNormal
+	switch {
+	case v >= r.crit:
+		next = alertCritical
+	case v >= r.warn:
+		next = alertWarning
+	}
+	if next >= cur {
+		return next
+	}
+	enter := []float64{0, r.warn, r.crit}
+	for cur > next && v < enter[cur]-r.hysteresis {
+		cur--
+	}
+	return cur
+}
+
+// gpuAlerts keeps each GPU's alert level per metric across polls.
+type gpuAlerts struct {
+	rules  []*alertRule
+	levels map[string][]int // by UUID, one per rule; guarded by pollMu
+}
+
+func newGPUAlerts() *gpuAlerts {
+	pctHysteresis := envFloat("ALERT_PCT_HYSTERESIS", 5)
+	a := &gpuAlerts{
+		rules: []*alertRule{
+			{
+				name:       "temperature",
+				warn:       envFloat("ALERT_TEMP_WARN_C", 80),
+				crit:       envFloat("ALERT_TEMP_CRIT_C", 90),
+				hysteresis: envFloat("ALERT_TEMP_HYSTERESIS_C", 5),
+				value:      func(g *GPUInfo) float64 { return float64(g.TemperatureC) },
+			},
+			{
+				name:       "power",
+				warn:       envFloat("ALERT_POWER_WARN_PCT", 95),
+				crit:       envFloat("ALERT_POWER_CRIT_PCT", 100),
+				hysteresis: pctHysteresis,
+				value: func(g *GPUInfo) float64 {
+					if g.PowerLimitW <= 0 {
+						return 0
+					}
+					return g.PowerDrawW / g.PowerLimitW * 100
+				},
+			},
+			{
+				name:       "memory",
+				warn:       envFloat("ALERT_MEMORY_WARN_PCT", 90),
+				crit:       envFloat("ALERT_MEMORY_CRIT_PCT", 97),
+				hysteresis: pctHysteresis,
+				value: func(g *GPUInfo) float64 {
+					if g.MemoryTotalMiB <= 0 {
+						return 0
+					}
+					return float64(g.MemoryUsedMiB) / float64(g.MemoryTotalMiB) * 100
+				},
+			},
+		},
+		levels: make(map[string][]int),
+	}
+	for _, r := range a.rules {
+		if r.crit < r.warn {
+			log.Printf("alert %s: critical level %g is below warning level %g, using %g", r.name, r.crit, r.warn, r.warn)
+			r.crit = r.warn
+		}
+	}
+	return a
+}
+
+// apply updates every GPU's levels and sets AlertLevel to the most severe
+// one, logging changes.
+func (a *gpuAlerts) apply(metrics *GPUMetrics) {
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		levels := a.levels[g.UUID]
+		if levels == nil {
+			levels = make([]int, len(a.rules))
+			a.levels[g.UUID] = levels
+		}
+		worst := alertNormal
+		for j, r := range a.rules {
+			v := r.value(g)
+			next := r.level(levels[j], v)
+			if next != levels[j] {
+				log.Printf("gpu %d (%s): %s %s -> %s (%.0f)", g.Index, g.UUID, r.name,
+					alertLevelNames[levels[j]], alertLevelNames[next], v)
+				levels[j] = next
+			}
+			worst = max(worst, next)
+		}
+		g.AlertLevel = alertLevelNames[worst]
+	}
+}
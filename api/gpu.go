@@ -0,0 +1,198 @@
+// Package api holds the JSON data types served by go-smi-api, shared by
+// the server and the client package.
+package api
+
+// SchemaVersion versions these types as the server produces them. It is
+// bumped when a field is renamed or removed or its meaning changes; new
+// fields don't bump it.
+const SchemaVersion = 1
+
+type GPUProcess struct {
+	PID           int    `json:"pid"`
+	ProcessName   string `json:"process_name"`
+	UsedMemoryMiB int    `json:"used_memory_mib"`
+	// ProcessNameShort is nvidia-smi's own, possibly truncated, name. It
+	// is set when ProcessName was replaced by the full executable path
+	// from /proc.
+	ProcessNameShort string `json:"process_name_short,omitempty"`
+	// SMUtilPct and MemUtilPct come from `nvidia-smi pmon` and are only
+	// populated when GPU_PROCESS_UTIL=true.
+	SMUtilPct  int `json:"sm_util_pct"`
+	MemUtilPct int `json:"mem_util_pct"`
+	// CgroupPath, ContainerID and PodUID attribute the process to a
+	// container or Kubernetes pod. They are empty when the process isn't
+	// containerized or its PID isn't visible here.
+	CgroupPath  string `json:"cgroup_path,omitempty"`
+	ContainerID string `json:"container_id,omitempty"`
+	PodUID      string `json:"pod_uid,omitempty"`
+	// Highlighted is set for processes matching HIGHLIGHT_PROCESSES.
+	// MergedCount is only set on the "other" entry that the remaining
+	// processes are collapsed into with COLLAPSE_OTHER_PROCESSES, and is
+	// the number of processes it stands for.
+	Highlighted bool `json:"highlighted"`
+	MergedCount int  `json:"merged_count,omitempty"`
+}
+
+type GPUInfo struct {
+	Index             int          `json:"index"`
+	Name              string       `json:"name"`
+	UUID              string       `json:"uuid"`
+	PCIBusID          string       `json:"pci_bus_id,omitempty"` // e.g. "00000000:3B:00.0"
+	DriverVersion     string       `json:"driver_version"`
+	PersistenceMode   string       `json:"persistence_mode"` // "enabled", "disabled", or "" if not reported
+	TemperatureC      int          `json:"temperature_c"`
+	FanSpeedPct       int          `json:"fan_speed_pct"`
+	HasFan            bool         `json:"has_fan"` // false on passively cooled GPUs, where fan_speed_pct means nothing
+	PowerDrawW        float64      `json:"power_draw_w"`
+	PowerLimitW       float64      `json:"power_limit_w"`
+	MemoryUsedMiB     int          `json:"memory_used_mib"`
+	MemoryTotalMiB    int          `json:"memory_total_mib"`
+	MemoryFreeMiB     int          `json:"memory_free_mib"`
+	MemoryReservedMiB int          `json:"memory_reserved_mib"` // used memory not held by any listed process
+	GPUUtilizationPct int          `json:"gpu_utilization_pct"`
+	MemUtilizationPct int          `json:"mem_utilization_pct"`
+	UtilPerWatt       float64      `json:"util_per_watt"` // utilization % per watt drawn
+	PState            string       `json:"pstate"`
+	PStateLevel       int          `json:"pstate_level"` // 0 for P0 (fastest) to 15; -1 if unknown
+	PCIEGenCurrent    int          `json:"pcie_gen_current"`
+	PCIEGenMax        int          `json:"pcie_gen_max"`
+	ComputeCapability string       `json:"compute_capability"`
+	Architecture      string       `json:"architecture"`
+	VGPU              *VGPUInfo    `json:"vgpu,omitempty"` // set inside a vGPU guest
+	NVLink            []NVLinkInfo `json:"nvlink,omitempty"`
+	Processes         []GPUProcess `json:"processes"`
+
+	// MemoryTrendMiBPerMin is the slope of MemoryUsedMiB over the trend
+	// window; MemoryGrowing flags sustained growth above the threshold.
+	MemoryTrendMiBPerMin float64 `json:"memory_trend_mib_per_min"`
+	MemoryGrowing        bool    `json:"memory_growing"`
+
+	// Exponential moving averages across polls (SMOOTHING_ALPHA), for
+	// charts that don't want second-to-second jitter.
+	GPUUtilizationPctSmoothed float64 `json:"gpu_utilization_pct_smoothed"`
+	PowerDrawWSmoothed        float64 `json:"power_draw_w_smoothed"`
+	TemperatureCSmoothed      float64 `json:"temperature_c_smoothed"`
+
+	// GPUUtilizationPeakPct is the highest utilization seen since the
+	// previous snapshot when sub-second sampling (GPU_SAMPLE_INTERVAL) is
+	// on; otherwise it equals GPUUtilizationPct.
+	GPUUtilizationPeakPct int `json:"gpu_utilization_peak_pct"`
+
+	// AlertLevel is "normal", "warning" or "critical": the most severe
+	// of the temperature, power and memory alert states (ALERT_*).
+	AlertLevel string `json:"alert_level"`
+
+	// CoolingSuspect flags a GPU running hot while its fan is barely
+	// spinning, a sign of a failed fan or fan controller. It is never set
+	// on GPUs without a fan.
+	CoolingSuspect bool `json:"cooling_suspect"`
+
+	// RowRemapping is nil on GPUs that don't support row remapping.
+	RowRemapping *RowRemapInfo `json:"row_remapping,omitempty"`
+
+	// PersistenceAdvisory is a hint set on idle GPUs with persistence
+	// mode off, where the driver is torn down and reinitialized around
+	// every job.
+	PersistenceAdvisory string `json:"persistence_advisory,omitempty"`
+
+	// Specs are the GPU model's published peak throughputs; nil for
+	// models not in the built-in table.
+	Specs *GPUSpecs `json:"specs,omitempty"`
+
+	// The *Available flags are false when the GPU didn't report the
+	// value (nvidia-smi's [N/A], or a field the driver doesn't support),
+	// so that the 0 next to them means unknown rather than idle. HasFan
+	// does the same for FanSpeedPct.
+	TemperatureAvailable    bool `json:"temperature_c_available"`
+	PowerDrawAvailable      bool `json:"power_draw_w_available"`
+	PowerLimitAvailable     bool `json:"power_limit_w_available"`
+	GPUUtilizationAvailable bool `json:"gpu_utilization_pct_available"`
+	MemUtilizationAvailable bool `json:"mem_utilization_pct_available"`
+
+	// Extra holds the EXTRA_GPU_FIELDS values as nvidia-smi reported them.
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+type GPUMetrics struct {
+	Timestamp string    `json:"timestamp"`
+	GPUs      []GPUInfo `json:"gpus"`
+	// ProcessInfoLimited is set when process PIDs reported by nvidia-smi
+	// are not resolvable in this PID namespace (e.g. inside a container),
+	// so per-process details beyond nvidia-smi's own output are missing.
+	ProcessInfoLimited bool `json:"process_info_limited"`
+	// MissingGPUs lists GPUs seen by an earlier poll that have since
+	// disappeared.
+	MissingGPUs []MissingGPU `json:"missing_gpus"`
+	// QueryDurationMs is how long the poll took to read the GPUs, mostly
+	// time spent waiting on nvidia-smi.
+	QueryDurationMs float64 `json:"query_duration_ms"`
+	// SpecsTotal adds up the Specs of the GPUs that have them.
+	SpecsTotal *GPUSpecs `json:"specs_total,omitempty"`
+	// SchemaVersion is the SchemaVersion of the server that produced this.
+	SchemaVersion int `json:"schema_version"`
+	// Stale is set when the polls since this snapshot failed, for the
+	// reason in StaleReason (see the reasons of the /api/gpus 503).
+	Stale       bool   `json:"stale,omitempty"`
+	StaleReason string `json:"stale_reason,omitempty"`
+}
+
+// GPUSpecs are dense (non-sparse) tensor-core peaks as published by
+// NVIDIA; 0 means not published or not supported.
+type GPUSpecs struct {
+	FP16TFLOPS float64 `json:"fp16_tflops"`
+	BF16TFLOPS float64 `json:"bf16_tflops"`
+	INT8TOPS   float64 `json:"int8_tops"`
+}
+
+// MissingGPU is a GPU that was reported by an earlier poll but no longer
+// is, typically because it fell off the PCIe bus.
+type MissingGPU struct {
+	UUID     string `json:"uuid"`
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	PCIBusID string `json:"pci_bus_id,omitempty"`
+	LastSeen string `json:"last_seen"`
+	// LastXID is the most recent NVIDIA Xid line the kernel logged for
+	// the GPU's PCI bus ID; empty if there is none or dmesg isn't
+	// readable.
+	LastXID string `json:"last_xid,omitempty"`
+}
+
+// NVLinkInfo is the state of one NVLink of a GPU.
+type NVLinkInfo struct {
+	Link           int     `json:"link"`
+	State          string  `json:"state"` // "up" or "down"
+	BandwidthGBs   float64 `json:"bandwidth_gb_s"`
+	ReplayErrors   int64   `json:"replay_errors"`
+	RecoveryErrors int64   `json:"recovery_errors"`
+	CRCErrors      int64   `json:"crc_errors"`
+}
+
+// RowRemapInfo is a GPU's row-remapping status (Ampere and later). Rows
+// are remapped after memory errors; pending remaps take effect on the
+// next GPU reset, and a failed remap means the GPU should be replaced.
+type RowRemapInfo struct {
+	Correctable   int  `json:"correctable"`   // rows remapped after correctable errors
+	Uncorrectable int  `json:"uncorrectable"` // rows remapped after uncorrectable errors
+	PendingRemap  bool `json:"pending_remap"`
+	RemapFailure  bool `json:"remap_failure"`
+}
+
+// VGPUInfo describes the vGPU slice a virtual machine sees. It is only set
+// when nvidia-smi reports the GPU's virtualization mode as VGPU, i.e. we
+// run inside a guest; the usual memory and utilization fields then refer
+// to the slice, not the physical card.
+type VGPUInfo struct {
+	Type            string `json:"type"` // vGPU profile, e.g. "GRID T4-4Q"
+	FramebufferMiB  int    `json:"framebuffer_mib"`
+	LicensedProduct string `json:"licensed_product,omitempty"`
+	LicenseStatus   string `json:"license_status,omitempty"`
+	Licensed        bool   `json:"licensed"`
+}
+
+// Snapshot is one message of the /ws stream.
+type Snapshot struct {
+	SchemaVersion int          `json:"schema_version"`
+	GPU           *GPUMetrics  `json:"gpu"`
+	Ollama        *OllamaStats `json:"ollama"`
+}
@@ -0,0 +1,133 @@
+package api
+
+type KVCacheInfo struct {
+	DType         string `json:"dtype"`
+	BytesPerToken int    `json:"bytes_per_token"`
+	// MaxSizeBytes is an upper bound: the cache for a full context
+	// window, not what is held now.
+	MaxSizeBytes int64   `json:"max_size_bytes"`
+	MaxSizeMiB   float64 `json:"max_size_mib"`
+	// CurrentUsedBytes estimates the cache actually resident: size_vram
+	// minus the pulled model's size (the weights) and the activation
+	// estimate, capped at MaxSizeBytes. It is 0 when the model is
+	// partially offloaded to the CPU or its size is unknown.
+	CurrentUsedBytes int64 `json:"current_used_bytes"`
+	// Clamped is set when the computed size exceeded the model's VRAM
+	// allocation and was capped to it.
+	Clamped bool `json:"clamped"`
+	// AssumedDType is our OLLAMA_KV_CACHE_TYPE; DetectedDType is what a
+	// local Ollama server is actually configured with, when readable.
+	// DType is the one the estimate used: the detected one if known.
+	AssumedDType  string `json:"assumed_dtype"`
+	DetectedDType string `json:"detected_dtype,omitempty"`
+	DTypeMismatch bool   `json:"dtype_mismatch"`
+
+	// The inputs of the estimate, so it can be checked by hand:
+	// bytes_per_token = layers * kv_heads * (key_length + value_length)
+	// * bytes_per_element, and max_size_bytes = bytes_per_token * tokens.
+	// FlashAttention doesn't change the cache size; it is reported with
+	// the estimate because it decides whether a quantized cache is used.
+	Layers          int     `json:"layers"`
+	KVHeads         int     `json:"kv_heads"`
+	KeyLength       int     `json:"key_length"`
+	ValueLength     int     `json:"value_length"`
+	BytesPerElement float64 `json:"bytes_per_element"`
+	Tokens          int     `json:"tokens"`
+	FlashAttention  bool    `json:"flash_attention"`
+}
+
+type VRAMBreakdown struct {
+	TotalBytes      int64 `json:"total_bytes"`
+	WeightsEstBytes int64 `json:"weights_est_bytes"`
+	KVCacheMaxBytes int64 `json:"kv_cache_max_bytes"`
+	// ActivationEstBytes is the attention score buffer for one layer and
+	// a 512-token batch (heads * tokens * 512 * f32). FlashAttention never
+	// materializes it, so it is 0 then. It is capped to what the model's
+	// allocation leaves after the KV cache. Other compute buffers aren't
+	// estimated.
+	ActivationEstBytes int64 `json:"activation_est_bytes"`
+}
+
+type RunningModel struct {
+	Name          string        `json:"name"`
+	BaseName      string        `json:"base_name"`
+	Tag           string        `json:"tag"`
+	SizeVRAMBytes int64         `json:"size_vram_bytes"`
+	ParameterSize string        `json:"parameter_size"`
+	Quantization  string        `json:"quantization"`
+	Family        string        `json:"family"`
+	ExpiresAt     string        `json:"expires_at"`
+	ContextWindow int           `json:"context_window"`
+	SlidingWindow int           `json:"sliding_window"`
+	IsEmbedding   bool          `json:"is_embedding"`
+	IsMultimodal  bool          `json:"is_multimodal"`
+	KVCache       KVCacheInfo   `json:"kv_cache"`
+	VRAM          VRAMBreakdown `json:"vram"`
+
+	// KeepAliveSeconds is -1 when the model never unloads and 0 when it
+	// unloads as soon as it goes idle. KeepAliveSource says whether it
+	// came from the model's keep_alive parameter or, as the time left
+	// until expires_at, from /api/ps.
+	KeepAliveSeconds int    `json:"keep_alive_seconds"`
+	KeepAliveSource  string `json:"keep_alive_source"`
+
+	// Placement is a best-effort guess of the GPUs holding the model; nil
+	// when it can't be inferred. See ModelPlacement.
+	Placement *ModelPlacement `json:"placement,omitempty"`
+}
+
+type AvailableModel struct {
+	Name          string `json:"name"`
+	BaseName      string `json:"base_name"`
+	Tag           string `json:"tag"`
+	SizeBytes     int64  `json:"size_bytes"`
+	ParameterSize string `json:"parameter_size"`
+	Quantization  string `json:"quantization"`
+	Family        string `json:"family"`
+	ModifiedAt    string `json:"modified_at"`
+	// Path is the weights blob and DiskSizeBytes the size of all the
+	// model's blobs on disk; both are only set when the Ollama models
+	// directory is readable from this process.
+	Path          string `json:"path,omitempty"`
+	DiskSizeBytes int64  `json:"disk_size_bytes,omitempty"`
+}
+
+type ModelCatalog struct {
+	Timestamp string           `json:"timestamp"`
+	ModelsDir string           `json:"models_dir"` // "" if Ollama is remote or the directory is unreadable
+	Models    []AvailableModel `json:"models"`
+}
+
+type OllamaStats struct {
+	Timestamp            string         `json:"timestamp"`
+	Running              bool           `json:"running"`
+	Version              string         `json:"version"`
+	RunningModels        []RunningModel `json:"running_models"`
+	AvailableModelsCount int            `json:"available_models_count"`
+	TotalDiskUsageBytes  int64          `json:"total_disk_usage_bytes"`
+	// MaxParallel and MaxLoadedModels are the OLLAMA_NUM_PARALLEL and
+	// OLLAMA_MAX_LOADED_MODELS settings of a local Ollama server; 0 when
+	// unset (Ollama picks automatically) or not discoverable.
+	MaxParallel     int `json:"max_parallel"`
+	MaxLoadedModels int `json:"max_loaded_models"`
+	// ProbeState is "backoff" while Ollama is unreachable and only probed
+	// every OLLAMA_BACKOFF_INTERVAL, otherwise "normal".
+	ProbeState string `json:"probe_state"`
+	// FetchDurationMs is how long the poll took to query Ollama.
+	FetchDurationMs float64 `json:"fetch_duration_ms"`
+	// SchemaVersion is the SchemaVersion of the server that produced this.
+	SchemaVersion int `json:"schema_version"`
+}
+
+// ModelPlacement is a heuristic guess of which GPUs hold a running model.
+// Ollama doesn't report this, so it is inferred from the GPU process list:
+// each loaded model is served by its own Ollama runner process, which
+// appears on every GPU it uses, and the runner's total GPU memory should
+// be close to the model's size_vram.
+type ModelPlacement struct {
+	GPUIndexes []int `json:"gpu_indexes"`
+	// Confidence is "high" on single-GPU hosts or when the runner's
+	// memory is within 10% of size_vram, "medium" within 25%, else "low".
+	Confidence string `json:"confidence"`
+	Method     string `json:"method"` // "single_gpu" or "process_memory"
+}
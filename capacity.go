@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errModelNotFound = errors.New("model not found")
+
+// ModelCapacity answers "how many more copies of this model fit?" from the
+// free VRAM of the latest GPU snapshot. Ollama can split a model across
+// GPUs, so SplitFit, which pools the free memory of all GPUs, is an upper
+// bound on TotalFit, which only counts whole copies per GPU.
+type ModelCapacity struct {
+	Timestamp string `json:"timestamp"`
+	Model     string `json:"model"`
+	// Source is "running" when the footprint comes from the loaded model,
+	// or "show" when it was estimated from /api/show and the model's
+	// pulled size.
+	Source             string        `json:"source"`
+	FootprintBytes     int64         `json:"footprint_bytes"`
+	WeightsEstBytes    int64         `json:"weights_est_bytes"`
+	KVCacheMaxBytes    int64         `json:"kv_cache_max_bytes"`
+	ActivationEstBytes int64         `json:"activation_est_bytes"`
+	GPUs               []GPUCapacity `json:"gpus"`
+	TotalFit           int           `json:"total_fit"`
+	SplitFit           int           `json:"split_fit"`
+}
+
+type GPUCapacity struct {
+	Index     int    `json:"index"`
+	UUID      string `json:"uuid"`
+	FreeBytes int64  `json:"free_bytes"`
+	Fit       int    `json:"fit"`
+}
+
+// modelFootprint is the VRAM one instance of a model needs.
+type modelFootprint struct {
+	source                  string
+	weights, kv, activation int64
+}
+
+func (f modelFootprint) total() int64 {
+	return f.weights + f.kv + f.activation
+}
+
+// Footprint returns the VRAM an instance of the named model needs: from
+// the running model if it is loaded, otherwise estimated from /api/show
+// and its pulled size. It returns errModelNotFound if Ollama doesn't
+// have the model.
+func (m *OllamaMonitor) Footprint(name string) (modelFootprint, error) {
+	if stats := m.Latest(); stats != nil {
+		for _, rm := range stats.RunningModels {
+			if !sameModel(rm.Name, name) {
+				continue
+			}
+			f := modelFootprint{"running", rm.VRAM.WeightsEstBytes, rm.VRAM.KVCacheMaxBytes, rm.VRAM.ActivationEstBytes}
+			if f.total() == 0 {
+				f.weights = rm.SizeVRAMBytes
+			}
+			return f, nil
+		}
+	}
+
+	var weights int64
+	found := false
+	if catalog := m.Catalog(); catalog != nil {
+		for _, am := range catalog.Models {
+			if sameModel(am.Name, name) {
+				weights, found = am.SizeBytes, true
+				break
+			}
+		}
+	}
+	if !found || m.mock {
+		return modelFootprint{}, errModelNotFound
+	}
+	show, err := m.fetchShow(name)
+	if err != nil {
+		return modelFootprint{}, err
+	}
+	f := modelFootprint{source: "show", weights: weights}
+	arch := modelInfoString(show.ModelInfo, "general.architecture")
+	if arch == "" {
+		arch = show.Details.Family
+	}
+	if isEmbeddingModel(show, arch) {
+		return f, nil
+	}
+	var serverEnv map[string]string
+	if isLocalHost(m.host) {
+		serverEnv = ollamaServerEnv()
+	}
+	_, _, dtype, flashAttn := kvCacheSettings(serverEnv, m.kvCacheType, m.flashAttn)
+	_, _, kvTokens := contextTokens(show, arch, false)
+	if kv, activation, ok := estimateKVCache(show.ModelInfo, arch, kvTokens, dtype, flashAttn, 0); ok {
+		f.kv, f.activation = kv.MaxSizeBytes, activation
+	}
+	return f, nil
+}
+
+// sameModel compares model names, treating a missing tag as ":latest".
+func sameModel(a, b string) bool {
+	baseA, tagA := splitModelName(a)
+	baseB, tagB := splitModelName(b)
+	return baseA == baseB && tagA == tagB
+}
+
+// modelCapacity works out how many instances of a model with footprint f
+// fit into the free memory of the GPUs in metrics.
+func modelCapacity(model string, f modelFootprint, metrics *GPUMetrics) (*ModelCapacity, error) {
+	need := f.total()
+	if need <= 0 {
+		return nil, fmt.Errorf("no size known for %s", model)
+	}
+	c := &ModelCapacity{
+		Timestamp:          time.Now().UTC().Format(time.RFC3339),
+		Model:              model,
+		Source:             f.source,
+		FootprintBytes:     need,
+		WeightsEstBytes:    f.weights,
+		KVCacheMaxBytes:    f.kv,
+		ActivationEstBytes: f.activation,
+		GPUs:               []GPUCapacity{},
+	}
+	var free int64
+	for _, g := range metrics.GPUs {
+		gc := GPUCapacity{
+			Index:     g.Index,
+			UUID:      g.UUID,
+			FreeBytes: int64(g.MemoryFreeMiB) << 20,
+		}
+		gc.Fit = int(gc.FreeBytes / need)
+		c.GPUs = append(c.GPUs, gc)
+		c.TotalFit += gc.Fit
+		free += gc.FreeBytes
+	}
+	c.SplitFit = int(free / need)
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Runtimes name a container's cgroup after its 64-hex-digit ID, e.g.
+	// ".../docker-<id>.scope" or ".../cri-containerd-<id>.scope".
+	containerIDRe = regexp.MustCompile(`[0-9a-f]{64}`)
+	// The kubelet puts pods under "pod<uid>", with dashes as underscores
+	// under the systemd cgroup driver.
+	podUIDRe = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// processCgroup reads /proc/<pid>/cgroup and returns the process's cgroup
+// path and, when it runs in a container, the container ID and Kubernetes
+// pod UID. Everything is empty if the file is unreadable.
+func processCgroup(pid int) (path, containerID, podUID string) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", "", ""
+	}
+	return parseCgroup(string(data))
+}
+
+// parseCgroup picks the unified (v2) hierarchy line "0::<path>" when
+// present, else the v1 memory controller, else the first line.
+func parseCgroup(data string) (path, containerID, podUID string) {
+	var first, memory string
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			path = parts[2]
+			break
+		}
+		if first == "" {
+			first = parts[2]
+		}
+		if memory == "" && strings.Contains(","+parts[1]+",", ",memory,") {
+			memory = parts[2]
+		}
+	}
+	if path == "" {
+		path = memory
+	}
+	if path == "" {
+		path = first
+	}
+
+	if ids := containerIDRe.FindAllString(path, -1); len(ids) > 0 {
+		containerID = ids[len(ids)-1]
+	}
+	if m := podUIDRe.FindStringSubmatch(path); m != nil {
+		podUID = strings.ReplaceAll(m[1], "_", "-")
+	}
+	return path, containerID, podUID
+}
@@ -0,0 +1,162 @@
+// Package client is a Go client for the go-smi-api HTTP and WebSocket API.
+// Responses are decoded into the types of package api, the same ones the
+// server encodes.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/shostkevych/go-smi-api/api"
+)
+
+// Snapshot is one message of the WebSocket stream.
+type Snapshot = api.Snapshot
+
+// ErrNoData is matched by errors.Is when the server is up but hasn't
+// completed its first poll yet (503 "no data yet"). Retrying shortly is
+// the right response.
+var ErrNoData = errors.New("no data yet")
+
+// APIError is a non-2xx response. Reason is the server's machine-readable
+// reason (e.g. "driver_not_loaded"), when it sent one.
+type APIError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("go-smi-api: %d %s: %s", e.StatusCode, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("go-smi-api: %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrNoData && e.StatusCode == http.StatusServiceUnavailable &&
+		(e.Reason == "no_data" || e.Message == "no data yet")
+}
+
+type Client struct {
+	baseURL string
+	// HTTPClient is used for REST calls; http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// WSToken is the server's WS_TOKEN, if it has one. StreamWebSocket
+	// offers it as a subprotocol, which keeps it out of access logs.
+	WSToken string
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "http://gpu-host:8080".
+func New(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// GetGPUs fetches /api/gpus.
+func (c *Client) GetGPUs(ctx context.Context) (*api.GPUMetrics, error) {
+	var out api.GPUMetrics
+	if err := c.get(ctx, "/api/gpus", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOllamaStats fetches /api/ollama/stats.
+func (c *Client) GetOllamaStats(ctx context.Context) (*api.OllamaStats, error) {
+	var out api.OllamaStats
+	if err := c.get(ctx, "/api/ollama/stats", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return readAPIError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// readAPIError builds an APIError from a JSON {"error", "reason"} body or,
+// for endpoints that answer in plain text, the body itself.
+func readAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &APIError{StatusCode: resp.StatusCode}
+	var apiErr struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+		e.Message, e.Reason = apiErr.Error, apiErr.Reason
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// StreamWebSocket connects to /ws and sends every snapshot on the returned
+// channel. The channel is closed when ctx is done or the connection
+// fails; reconnecting is up to the caller.
+func (c *Client) StreamWebSocket(ctx context.Context) (<-chan Snapshot, error) {
+	url := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/ws"
+	dialer := *websocket.DefaultDialer
+	if c.WSToken != "" {
+		dialer.Subprotocols = []string{c.WSToken}
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			// Rejected by the server, e.g. 401 for a wrong WSToken.
+			return nil, readAPIError(resp)
+		}
+		return nil, err
+	}
+	ch := make(chan Snapshot)
+	done := make(chan struct{})
+	go func() {
+		// Unblock the reader when ctx ends.
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	go func() {
+		defer close(ch)
+		defer close(done)
+		defer conn.Close()
+		for {
+			var s Snapshot
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			select {
+			case ch <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClusterGPU is a GPU reported by a peer, tagged with the peer it came from.
+type ClusterGPU struct {
+	Host string `json:"host"`
+	GPUInfo
+}
+
+type PeerStatus struct {
+	Host      string `json:"host"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type ClusterGPUs struct {
+	Timestamp string       `json:"timestamp"`
+	GPUs      []ClusterGPU `json:"gpus"`
+	Peers     []PeerStatus `json:"peers"`
+}
+
+// Cluster aggregates /api/gpus from other instances of this service.
+type Cluster struct {
+	peers  []string
+	client *http.Client
+}
+
+func NewCluster() *Cluster {
+	var peers []string
+	for _, p := range envList("PEER_HOSTS") {
+		if !strings.HasPrefix(p, "http") {
+			p = "http://" + p
+		}
+		peers = append(peers, strings.TrimRight(p, "/"))
+	}
+	return &Cluster{
+		peers:  peers,
+		client: &http.Client{Timeout: envDuration("PEER_TIMEOUT", 3*time.Second)},
+	}
+}
+
+// Enabled reports whether any peers are configured.
+func (c *Cluster) Enabled() bool {
+	return len(c.peers) > 0
+}
+
+// GPUs fetches every peer concurrently. A peer that is down or returns
+// garbage is reported in Peers rather than failing the whole response.
+func (c *Cluster) GPUs(ctx context.Context) *ClusterGPUs {
+	results := make([]*GPUMetrics, len(c.peers))
+	statuses := make([]PeerStatus, len(c.peers))
+
+	var wg sync.WaitGroup
+	for i, peer := range c.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = PeerStatus{Host: peer}
+			metrics, err := c.fetchPeer(ctx, peer)
+			if err != nil {
+				statuses[i].Error = err.Error()
+				return
+			}
+			statuses[i].OK = true
+			statuses[i].Timestamp = metrics.Timestamp
+			results[i] = metrics
+		}()
+	}
+	wg.Wait()
+
+	out := &ClusterGPUs{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		GPUs:      []ClusterGPU{},
+		Peers:     statuses,
+	}
+	for i, metrics := range results {
+		if metrics == nil {
+			continue
+		}
+		for _, g := range metrics.GPUs {
+			out.GPUs = append(out.GPUs, ClusterGPU{Host: c.peers[i], GPUInfo: g})
+		}
+	}
+	return out
+}
+
+func (c *Cluster) fetchPeer(ctx context.Context, peer string) (*GPUMetrics, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/api/gpus", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var metrics GPUMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the monitors and the HTTP server. Each
+// field is read from the environment variable in its env tag, lists as
+// comma-separated values; fields tagged secret are redacted when the
+// configuration is printed. Settings
+// of the optional subsystems (alerts, safety watchdog, cluster, OTLP, ...)
+// are still read from the environment where they are used.
+type Config struct {
+	Mock bool `env:"MOCK"`
+
+	GPUBackend           string        `env:"GPU_BACKEND"`
+	GPUSampleInterval    time.Duration `env:"GPU_SAMPLE_INTERVAL"`
+	HistoryRetention     time.Duration `env:"HISTORY_RETENTION"`
+	PersistHistory       bool          `env:"PERSIST_HISTORY"`
+	PersistMaxBytes      int           `env:"PERSIST_MAX_BYTES"`
+	PersistInterval      time.Duration `env:"PERSIST_INTERVAL"`
+	MemoryTrendWindow    time.Duration `env:"MEMORY_TREND_WINDOW"`
+	MemoryTrendThreshold float64       `env:"MEMORY_TREND_THRESHOLD"` // MiB per minute
+	SmoothingAlpha       float64       `env:"SMOOTHING_ALPHA"`
+	CoolingTempC         int           `env:"COOLING_TEMP_C"`
+	CoolingMinFanPct     int           `env:"COOLING_MIN_FAN_PCT"`
+	PollJitter           float64       `env:"POLL_JITTER"`
+	GPUIDs               string        `env:"GPU_IDS"`
+	SMIStrategy          string        `env:"SMI_STRATEGY"`
+	ExtraGPUFields       []string      `env:"EXTRA_GPU_FIELDS"`
+	GPUProcessUtil       bool          `env:"GPU_PROCESS_UTIL"`
+	ContainerMode        bool          `env:"CONTAINER_MODE"`
+
+	OllamaHost            string        `env:"OLLAMA_HOST"`
+	OllamaHeaders         string        `env:"OLLAMA_HEADERS" secret:"true"`
+	OllamaPollInterval    time.Duration `env:"OLLAMA_POLL_INTERVAL"`
+	OllamaShowRefresh     time.Duration `env:"OLLAMA_SHOW_REFRESH"`
+	OllamaShowTimeout     time.Duration `env:"OLLAMA_SHOW_TIMEOUT"`
+	OllamaShowConcurrency int           `env:"OLLAMA_SHOW_CONCURRENCY"`
+	OllamaBreakerFailures int           `env:"OLLAMA_BREAKER_FAILURES"`
+	OllamaBackoffInterval time.Duration `env:"OLLAMA_BACKOFF_INTERVAL"`
+	OllamaKVCacheType     string        `env:"OLLAMA_KV_CACHE_TYPE"`
+	OllamaFlashAttention  bool          `env:"OLLAMA_FLASH_ATTENTION"`
+
+	AdminAddr          string        `env:"ADMIN_ADDR"`
+	HandlerTimeout     time.Duration `env:"HANDLER_TIMEOUT"`
+	LongPollMaxWait    time.Duration `env:"LONGPOLL_MAX_WAIT"`
+	CatalogMaxAge      time.Duration `env:"CATALOG_MAX_AGE"`
+	RefreshMinInterval time.Duration `env:"REFRESH_MIN_INTERVAL"`
+	FloatPrecision     int           `env:"FLOAT_PRECISION"`
+	MaxBodyBytes       int           `env:"MAX_BODY_BYTES"`
+	AccessLog          bool          `env:"ACCESS_LOG"`
+	WSWriteTimeout     time.Duration `env:"WS_WRITE_TIMEOUT"`
+	WSToken            string        `env:"WS_TOKEN" secret:"true"`
+	EnableOllamaProxy  bool          `env:"ENABLE_OLLAMA_PROXY"`
+	ProxyMaxBodyBytes  int           `env:"PROXY_MAX_BODY_BYTES"`
+	EnableControl      bool          `env:"ENABLE_CONTROL"`
+	ControlToken       string        `env:"CONTROL_TOKEN" secret:"true"`
+	EnableDebug        bool          `env:"ENABLE_DEBUG"`
+	EnablePprof        bool          `env:"ENABLE_PPROF"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		GPUBackend:           "nvidia-smi",
+		HistoryRetention:     2 * time.Hour,
+		PersistMaxBytes:      64 << 20,
+		PersistInterval:      10 * time.Second,
+		MemoryTrendWindow:    10 * time.Minute,
+		MemoryTrendThreshold: 10,
+		SmoothingAlpha:       0.3,
+		CoolingTempC:         80,
+		CoolingMinFanPct:     20,
+		PollJitter:           0.1,
+		SMIStrategy:          "csv",
+
+		OllamaHost:            "http://localhost:11434",
+		OllamaPollInterval:    5 * time.Second,
+		OllamaShowRefresh:     10 * time.Minute,
+		OllamaShowTimeout:     30 * time.Second,
+		OllamaShowConcurrency: 2,
+		OllamaBreakerFailures: 3,
+		OllamaBackoffInterval: 30 * time.Second,
+		OllamaKVCacheType:     "f16",
+
+		HandlerTimeout:     10 * time.Second,
+		LongPollMaxWait:    30 * time.Second,
+		RefreshMinInterval: 2 * time.Second,
+		FloatPrecision:     2,
+		MaxBodyBytes:       1 << 20,
+		ProxyMaxBodyBytes:  256 << 20,
+		WSWriteTimeout:     10 * time.Second,
+	}
+}
+
+// loadConfig reads the configuration from the environment, after filling
+// in the variables it doesn't set from the JSON file at path, if any. The
+// file is an object keyed by environment variable name, so it can hold
+// any setting in the README, not only those in Config:
+//
+//	{"OLLAMA_HOST": "gpu-box:11434", "HISTORY_RETENTION": "6h", "ENABLE_DEBUG": true}
+//
+// Values that don't parse or are out of range are recorded as envProblems
+// and returned together as the error; the Config then holds defaults for
+// them.
+func loadConfig(path string) (*Config, error) {
+	if path != "" {
+		if err := loadConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+	c := defaultConfig()
+	v := reflect.ValueOf(c).Elem()
+	for i := range v.NumField() {
+		key := v.Type().Field(i).Tag.Get("env")
+		switch f := v.Field(i); f.Interface().(type) {
+		case bool:
+			f.SetBool(envBool(key))
+		case string:
+			if s := os.Getenv(key); s != "" {
+				f.SetString(s)
+			}
+		case int:
+			f.SetInt(int64(envInt(key, int(f.Int()))))
+		case float64:
+			f.SetFloat(envFloat(key, f.Float()))
+		case time.Duration:
+			f.SetInt(int64(envDuration(key, time.Duration(f.Int()))))
+		case []string:
+			f.Set(reflect.ValueOf(envList(key)))
+		}
+	}
+	c.validate()
+
+	var problems []string
+	envProblems.Range(func(_, msg any) bool {
+		problems = append(problems, msg.(string))
+		return true
+	})
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return c, errors.New(strings.Join(problems, "; "))
+	}
+	return c, nil
+}
+
+// loadConfigFile sets the variables in the file at path that aren't
+// already set in the environment, which takes precedence.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	var settings map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&settings); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	for key, val := range settings {
+		var s string
+		switch val := val.(type) {
+		case string:
+			s = val
+		case json.Number, bool:
+			s = fmt.Sprint(val)
+		case []any:
+			// Lists such as EXTRA_GPU_FIELDS are comma-separated.
+			items := make([]string, len(val))
+			for i, item := range val {
+				items[i] = fmt.Sprint(item)
+			}
+			s = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("config %s: %s: unsupported value %v", path, key, val)
+		}
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, s)
+		}
+	}
+	return nil
+}
+
+// validate records settings that parsed but make no sense, and resets
+// them to their defaults.
+func (c *Config) validate() {
+	def := defaultConfig()
+	if c.GPUBackend != "nvidia-smi" && c.GPUBackend != "dcgm" {
+		envProblem("GPU_BACKEND", fmt.Sprintf("unknown GPU_BACKEND=%q, want nvidia-smi or dcgm", c.GPUBackend))
+		c.GPUBackend = def.GPUBackend
+	}
+	if c.SmoothingAlpha <= 0 || c.SmoothingAlpha > 1 {
+		envProblem("SMOOTHING_ALPHA", fmt.Sprintf("invalid SMOOTHING_ALPHA=%g, want more than 0 and at most 1", c.SmoothingAlpha))
+		c.SmoothingAlpha = def.SmoothingAlpha
+	}
+	switch c.SMIStrategy {
+	case "csv":
+	case "xml":
+		// nvidia-smi -q -x has no --id or --query-gpu fields.
+		if c.GPUIDs != "" || len(c.ExtraGPUFields) > 0 {
+			envProblem("SMI_STRATEGY", "SMI_STRATEGY=xml doesn't support GPU_IDS or EXTRA_GPU_FIELDS, using csv")
+			c.SMIStrategy = def.SMIStrategy
+		}
+	default:
+		envProblem("SMI_STRATEGY", fmt.Sprintf("unknown SMI_STRATEGY=%q, want csv or xml", c.SMIStrategy))
+		c.SMIStrategy = def.SMIStrategy
+	}
+	c.OllamaKVCacheType = strings.ToLower(c.OllamaKVCacheType)
+	if _, ok := kvDtypeBytes[c.OllamaKVCacheType]; !ok {
+		envProblem("OLLAMA_KV_CACHE_TYPE", fmt.Sprintf("unknown OLLAMA_KV_CACHE_TYPE=%q, want one of %s", c.OllamaKVCacheType, strings.Join(slices.Sorted(maps.Keys(kvDtypeBytes)), ", ")))
+		c.OllamaKVCacheType = def.OllamaKVCacheType
+	}
+	if c.PollJitter < 0 || c.PollJitter > 0.5 {
+		envProblem("POLL_JITTER", fmt.Sprintf("invalid POLL_JITTER=%g, want 0 to 0.5", c.PollJitter))
+		c.PollJitter = def.PollJitter
+	}
+	if c.FloatPrecision > maxPrecision {
+		envProblem("FLOAT_PRECISION", fmt.Sprintf("invalid FLOAT_PRECISION=%d, want at most %d", c.FloatPrecision, maxPrecision))
+		c.FloatPrecision = maxPrecision
+	}
+	if c.OllamaShowConcurrency < 1 {
+		envProblem("OLLAMA_SHOW_CONCURRENCY", fmt.Sprintf("invalid OLLAMA_SHOW_CONCURRENCY=%d, want at least 1", c.OllamaShowConcurrency))
+		c.OllamaShowConcurrency = def.OllamaShowConcurrency
+	}
+	positive := func(key string, d *time.Duration, def time.Duration) {
+		if *d <= 0 {
+			envProblem(key, fmt.Sprintf("invalid %s=%s, want more than 0", key, *d))
+			*d = def
+		}
+	}
+	positive("HISTORY_RETENTION", &c.HistoryRetention, def.HistoryRetention)
+	positive("OLLAMA_POLL_INTERVAL", &c.OllamaPollInterval, def.OllamaPollInterval)
+	positive("HANDLER_TIMEOUT", &c.HandlerTimeout, def.HandlerTimeout)
+	// max-age is in whole seconds, so anything between 0 and 1s would
+	// round down to max-age=0.
+	if c.CatalogMaxAge < 0 || (c.CatalogMaxAge > 0 && c.CatalogMaxAge < time.Second) {
+		envProblem("CATALOG_MAX_AGE", fmt.Sprintf("invalid CATALOG_MAX_AGE=%s, want 0 or at least 1s", c.CatalogMaxAge))
+		c.CatalogMaxAge = def.CatalogMaxAge
+	}
+	if c.EnableControl && c.ControlToken == "" {
+		envProblem("CONTROL_TOKEN", "ENABLE_CONTROL needs CONTROL_TOKEN")
+		c.EnableControl = false
+	}
+}
+
+// print writes the configuration to w as one VARIABLE=value line per
+// setting, with secrets redacted.
+func (c *Config) print(w io.Writer) {
+	v := reflect.ValueOf(c).Elem()
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		val := fmt.Sprint(v.Field(i).Interface())
+		if list, ok := v.Field(i).Interface().([]string); ok {
+			val = strings.Join(list, ",")
+		}
+		if field.Tag.Get("secret") == "true" && val != "" {
+			val = "<redacted>"
+		}
+		fmt.Fprintf(w, "  %s=%s\n", field.Tag.Get("env"), val)
+	}
+}
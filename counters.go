@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Cumulative per-GPU counters, integrated from each poll's power draw and
+// utilization. They run from startup or the last reset, so a benchmark can
+// reset them before a run and read them after.
+
+// maxCounterGap caps the time a single sample is credited for, so a stall
+// in polling doesn't get extrapolated into a large jump.
+const maxCounterGap = 5 * time.Second
+
+// counterTypes are the counters that can be reset individually.
+var counterTypes = []string{"energy", "busy"}
+
+type GPUCounters struct {
+	Index int    `json:"index"`
+	UUID  string `json:"uuid"`
+	// EnergyWh is the energy drawn, in watt-hours.
+	EnergyWh float64 `json:"energy_wh"`
+	// BusySeconds is utilization-weighted time: a GPU at 50% for 10s
+	// adds 5.
+	BusySeconds float64 `json:"busy_seconds"`
+}
+
+type CounterSnapshot struct {
+	Timestamp string        `json:"timestamp"`
+	Since     string        `json:"since"` // start or last reset of any counter
+	GPUs      []GPUCounters `json:"gpus"`
+}
+
+type counters struct {
+	mu       sync.Mutex
+	since    time.Time
+	gpus     map[string]*GPUCounters
+	lastSeen map[string]time.Time
+}
+
+func newCounters() *counters {
+	return &counters{
+		since:    time.Now(),
+		gpus:     make(map[string]*GPUCounters),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// add credits each GPU with its power and utilization over the time since
+// its previous sample.
+func (c *counters) add(now time.Time, metrics *GPUMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range metrics.GPUs {
+		gc := c.gpus[g.UUID]
+		if gc == nil {
+			gc = &GPUCounters{UUID: g.UUID}
+			c.gpus[g.UUID] = gc
+		}
+		gc.Index = g.Index
+		if last, ok := c.lastSeen[g.UUID]; ok {
+			dt := min(now.Sub(last), maxCounterGap).Seconds()
+			gc.EnergyWh += g.PowerDrawW * dt / 3600
+			gc.BusySeconds += float64(g.GPUUtilizationPct) / 100 * dt
+		}
+		c.lastSeen[g.UUID] = now
+	}
+}
+
+func (c *counters) snapshot() *CounterSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshotLocked()
+}
+
+func (c *counters) snapshotLocked() *CounterSnapshot {
+	s := &CounterSnapshot{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Since:     c.since.UTC().Format(time.RFC3339),
+		GPUs:      []GPUCounters{},
+	}
+	for _, gc := range c.gpus {
+		g := *gc
+		g.EnergyWh = round2(g.EnergyWh)
+		g.BusySeconds = round2(g.BusySeconds)
+		s.GPUs = append(s.GPUs, g)
+	}
+	slices.SortFunc(s.GPUs, func(a, b GPUCounters) int { return a.Index - b.Index })
+	return s
+}
+
+// reset zeroes the named counter type, or all of them for "all", and
+// returns the values just before the reset.
+func (c *counters) reset(kind string) (*CounterSnapshot, error) {
+	if kind != "all" && !slices.Contains(counterTypes, kind) {
+		return nil, fmt.Errorf("invalid counter %q: want energy, busy or all", kind)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	before := c.snapshotLocked()
+	for _, gc := range c.gpus {
+		if kind == "all" || kind == "energy" {
+			gc.EnergyWh = 0
+		}
+		if kind == "all" || kind == "busy" {
+			gc.BusySeconds = 0
+		}
+	}
+	c.since = time.Now()
+	return before, nil
+}
+
+// Counters returns the cumulative per-GPU counters.
+func (m *GPUMonitor) Counters() *CounterSnapshot {
+	return m.counters.snapshot()
+}
+
+// ResetCounters zeroes the given counter type ("energy", "busy" or "all")
+// and returns the values at reset time.
+func (m *GPUMonitor) ResetCounters(kind string) (*CounterSnapshot, error) {
+	return m.counters.reset(kind)
+}
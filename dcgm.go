@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dcgmBackend scrapes an NVIDIA DCGM exporter's Prometheus endpoint instead
+// of running nvidia-smi. Fields DCGM doesn't export (or the exporter isn't
+// configured to collect) stay zero, and there is no process list.
+type dcgmBackend struct {
+	url    string
+	client *http.Client
+}
+
+func newDCGMBackend() *dcgmBackend {
+	url := os.Getenv("DCGM_EXPORTER_URL")
+	if url == "" {
+		url = "http://localhost:9400/metrics"
+	}
+	return &dcgmBackend{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// dcgmSetters maps DCGM field names to the GPUInfo field they populate.
+var dcgmSetters = map[string]func(g *GPUInfo, v float64){
+	"DCGM_FI_DEV_GPU_TEMP":          func(g *GPUInfo, v float64) { g.TemperatureC, g.TemperatureAvailable = int(v), true },
+	"DCGM_FI_DEV_FAN_SPEED":         func(g *GPUInfo, v float64) { g.FanSpeedPct, g.HasFan = int(v), true },
+	"DCGM_FI_DEV_POWER_USAGE":       func(g *GPUInfo, v float64) { g.PowerDrawW, g.PowerDrawAvailable = v, true },
+	"DCGM_FI_DEV_POWER_MGMT_LIMIT":  func(g *GPUInfo, v float64) { g.PowerLimitW, g.PowerLimitAvailable = v, true },
+	"DCGM_FI_DEV_FB_USED":           func(g *GPUInfo, v float64) { g.MemoryUsedMiB = int(v) },
+	"DCGM_FI_DEV_FB_FREE":           func(g *GPUInfo, v float64) { g.MemoryFreeMiB = int(v) },
+	"DCGM_FI_DEV_FB_TOTAL":          func(g *GPUInfo, v float64) { g.MemoryTotalMiB = int(v) },
+	"DCGM_FI_DEV_GPU_UTIL":          func(g *GPUInfo, v float64) { g.GPUUtilizationPct, g.GPUUtilizationAvailable = int(v), true },
+	"DCGM_FI_DEV_MEM_COPY_UTIL":     func(g *GPUInfo, v float64) { g.MemUtilizationPct, g.MemUtilizationAvailable = int(v), true },
+	"DCGM_FI_DEV_PCIE_LINK_GEN":     func(g *GPUInfo, v float64) { g.PCIEGenCurrent = int(v) },
+	"DCGM_FI_DEV_PCIE_MAX_LINK_GEN": func(g *GPUInfo, v float64) { g.PCIEGenMax = int(v) },
+}
+
+func (b *dcgmBackend) fetch() (*GPUMetrics, error) {
+	resp, err := b.client.Get(b.url)
+	if err != nil {
+		return nil, fmt.Errorf("dcgm exporter: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dcgm exporter: status %s", resp.Status)
+	}
+
+	byUUID := make(map[string]*GPUInfo)
+	reserved := make(map[string]int)
+	err = scanPrometheus(resp.Body, func(name string, labels map[string]string, value float64) {
+		uuid := labels["UUID"]
+		if uuid == "" {
+			return
+		}
+		g, ok := byUUID[uuid]
+		if !ok {
+			g = &GPUInfo{
+				Index:     parseInt(labels["gpu"]),
+				UUID:      uuid,
+				PCIBusID:  labels["pci_bus_id"],
+				Processes: []GPUProcess{},
+			}
+			byUUID[uuid] = g
+		}
+		if g.Name == "" {
+			g.Name = labels["modelName"]
+		}
+		if g.DriverVersion == "" {
+			g.DriverVersion = labels["DCGM_FI_DRIVER_VERSION"]
+		}
+		if name == "DCGM_FI_DEV_FB_RESERVED" {
+			reserved[uuid] = int(value)
+		} else if set, ok := dcgmSetters[name]; ok {
+			set(g, value)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dcgm exporter: %w", err)
+	}
+
+	gpus := make([]GPUInfo, 0, len(byUUID))
+	for uuid, g := range byUUID {
+		if g.MemoryTotalMiB == 0 {
+			g.MemoryTotalMiB = g.MemoryUsedMiB + g.MemoryFreeMiB + reserved[uuid]
+		}
+		gpus = append(gpus, *g)
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i].Index < gpus[j].Index })
+
+	return &GPUMetrics{
+		Timestamp:          time.Now().UTC().Format(time.RFC3339),
+		GPUs:               gpus,
+		ProcessInfoLimited: true,
+	}, nil
+}
+
+// scanPrometheus calls fn for every sample in a Prometheus text exposition.
+func scanPrometheus(r io.Reader, fn func(name string, labels map[string]string, value float64)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, rest := line, map[string]string{}, ""
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+			name, rest = line[:i], line[j+1:]
+			labels = parsePromLabels(line[i+1 : j])
+		} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		fn(name, labels, value)
+	}
+	return sc.Err()
+}
+
+// parsePromLabels parses the inside of a label set: a="x",b="y\"z".
+func parsePromLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			break
+		}
+		key := strings.TrimSpace(strings.TrimLeft(s[:eq], ","))
+		var val strings.Builder
+		i := eq + 2
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					val.WriteByte('\n')
+				default:
+					val.WriteByte(s[i])
+				}
+				continue
+			}
+			val.WriteByte(s[i])
+		}
+		labels[key] = val.String()
+		if i >= len(s) {
+			break
+		}
+		s = s[i+1:]
+	}
+	return labels
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var errNotSMI = errors.New("GPU metrics do not come from nvidia-smi (MOCK or GPU_BACKEND is set)")
+
+// rawOutput is the stdout of one nvidia-smi invocation, kept for
+// /api/debug/nvidia-smi.
+type rawOutput struct {
+	args []string
+	out  []byte
+	at   time.Time
+}
+
+func (b *smiBackend) recordRaw(dst *rawOutput, args []string, out []byte) {
+	b.rawMu.Lock()
+	defer b.rawMu.Unlock()
+	*dst = rawOutput{args: args, out: out, at: time.Now()}
+}
+
+// WriteRawSMI writes the raw output of the last GPU and process queries,
+// each preceded by the command line and when it ran.
+func (m *GPUMonitor) WriteRawSMI(w io.Writer) error {
+	if m.backend != gpuBackend(m.smi) {
+		return errNotSMI
+	}
+	b := m.smi
+	b.rawMu.Lock()
+	defer b.rawMu.Unlock()
+	for _, raw := range []rawOutput{b.rawGPUs, b.rawProcs} {
+		if raw.at.IsZero() {
+			continue
+		}
+		fmt.Fprintf(w, "# %s nvidia-smi %s\n", raw.at.UTC().Format(time.RFC3339), strings.Join(raw.args, " "))
+		w.Write(raw.out)
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// runDiagnostics is -diagnose: it checks nvidia-smi, the driver, Ollama
+// and the configuration one after the other, prints a report to w and
+// returns the exit status, 1 if a critical check failed. An unreachable
+// Ollama is only a warning, since the GPU API works without it. cfg and
+// cfgErr are loadConfig's results.
+func runDiagnostics(w io.Writer, cfg *Config, cfgErr error) int {
+	d := &diagnosis{w: w}
+	if cfg == nil {
+		d.fail("config", cfgErr.Error())
+		fmt.Fprintln(w, "\nsome checks failed")
+		return 1
+	}
+
+	// Building the monitors reads the rest of the configuration, so
+	// invalid values are known afterwards.
+	gpuMon := NewGPUMonitor(cfg)
+	ollamaMon := NewOllamaMonitor(cfg)
+
+	switch {
+	case gpuMon.mock:
+		d.pass("nvidia-smi", "skipped, MOCK=true")
+	case cfg.GPUBackend == "dcgm":
+		d.pass("nvidia-smi", "skipped, GPU_BACKEND=dcgm")
+	default:
+		if path, err := exec.LookPath("nvidia-smi"); err != nil {
+			d.fail("nvidia-smi", err.Error())
+		} else {
+			d.pass("nvidia-smi", path)
+		}
+	}
+
+	metrics, err := gpuMon.fetchGPUMetrics()
+	switch {
+	case cfg.GPUBackend == "dcgm" && !gpuMon.mock:
+		// DCGM reports the driver as a label on each metric, and not the
+		// CUDA version.
+		if err != nil || len(metrics.GPUs) == 0 || metrics.GPUs[0].DriverVersion == "" {
+			d.fail("driver", "DCGM didn't report a driver version")
+		} else {
+			d.pass("driver", "driver "+metrics.GPUs[0].DriverVersion)
+		}
+	default:
+		if driver, cuda := gpuMon.Versions(); driver == "" {
+			d.fail("driver", "nvidia-smi didn't report a driver version")
+		} else {
+			d.pass("driver", fmt.Sprintf("driver %s, CUDA %s", driver, cuda))
+		}
+	}
+
+	if err != nil {
+		d.fail("gpus", err.Error())
+	} else if len(metrics.GPUs) == 0 {
+		d.fail("gpus", "no GPUs reported")
+	} else {
+		names := make([]string, len(metrics.GPUs))
+		for i, g := range metrics.GPUs {
+			names[i] = fmt.Sprintf("%d: %s", g.Index, g.Name)
+		}
+		d.pass("gpus", strings.Join(names, ", "))
+	}
+
+	if stats, _ := ollamaMon.fetch(); !stats.Running {
+		d.warn("ollama", "not reachable at "+ollamaMon.Host())
+	} else {
+		d.pass("ollama", fmt.Sprintf("version %s at %s, %d models running", stats.Version, ollamaMon.Host(), len(stats.RunningModels)))
+	}
+
+	if cfg.EnableControl {
+		d.pass("control", "enabled")
+	} else {
+		d.pass("control", "disabled")
+	}
+
+	switch {
+	case !envBool("SAFETY_ENABLE"):
+		d.pass("safety", "disabled")
+	case gpuMon.safety == nil:
+		d.fail("safety", "SAFETY_ENABLE is set but the watchdog isn't armed; see the log above")
+	default:
+		if _, err := exec.LookPath("sh"); err != nil {
+			d.fail("safety", "SAFETY_CMD needs sh: "+err.Error())
+		} else {
+			d.pass("safety", "armed")
+		}
+	}
+
+	if cfg.PersistHistory {
+		if f, err := os.CreateTemp(dataDir(), ".diagnose-*"); err != nil {
+			d.fail("data dir", err.Error())
+		} else {
+			f.Close()
+			os.Remove(f.Name())
+			d.pass("data dir", dataDir()+" is writable")
+		}
+	}
+
+	var problems []string
+	envProblems.Range(func(_, msg any) bool {
+		problems = append(problems, msg.(string))
+		return true
+	})
+	slices.Sort(problems)
+	for _, p := range problems {
+		d.fail("config", p)
+	}
+	if len(problems) == 0 {
+		d.pass("config", "all settings parsed")
+	}
+
+	if d.failed {
+		fmt.Fprintln(w, "\nsome checks failed")
+		return 1
+	}
+	fmt.Fprintln(w, "\nall checks passed")
+	return 0
+}
+
+type diagnosis struct {
+	w      io.Writer
+	failed bool
+}
+
+func (d *diagnosis) pass(check, detail string) { d.report("PASS", check, detail) }
+func (d *diagnosis) warn(check, detail string) { d.report("WARN", check, detail) }
+
+func (d *diagnosis) fail(check, detail string) {
+	d.failed = true
+	d.report("FAIL", check, detail)
+}
+
+func (d *diagnosis) report(status, check, detail string) {
+	fmt.Fprintf(d.w, "[%s] %-10s %s\n", status, check, detail)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envProblems collects, by key, the environment variables that couldn't be
+// parsed, for -diagnose.
+var envProblems sync.Map
+
+func envProblem(key, msg string) {
+	envProblems.Store(key, msg)
+}
+
+// envBool reports whether the environment variable key is set to "true".
+// Anything but "true" or "false" is reported as a problem, since values
+// like "1" or "yes" silently mean false.
+func envBool(key string) bool {
+	v := os.Getenv(key)
+	if v != "" && v != "true" && v != "false" {
+		envProblem(key, fmt.Sprintf("%s=%q is neither true nor false, using false", key, v))
+	}
+	return v == "true"
+}
+
+// envDuration parses the environment variable key as a time.Duration,
+// returning def when it is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %s: %v", key, v, def, err)
+		envProblem(key, fmt.Sprintf("invalid %s=%q, using %s", key, v, def))
+		return def
+	}
+	return d
+}
+
+// envList splits the comma-separated environment variable key into its
+// trimmed, non-empty elements.
+func envList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envInt parses the environment variable key as an integer, returning def
+// when it is unset or invalid.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %d: %v", key, v, def, err)
+		envProblem(key, fmt.Sprintf("invalid %s=%q, using %d", key, v, def))
+		return def
+	}
+	return n
+}
+
+// envFloat parses the environment variable key as a float, returning def
+// when it is unset or invalid.
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %g: %v", key, v, def, err)
+		envProblem(key, fmt.Sprintf("invalid %s=%q, using %g", key, v, def))
+		return def
+	}
+	return f
+}
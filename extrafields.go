@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"slices"
+)
+
+// helpQueryFieldRe matches the quoted field names in the output of
+// nvidia-smi --help-query-gpu, e.g. "clocks.current.sm" or "clocks.sm".
+var helpQueryFieldRe = regexp.MustCompile(`"([a-z0-9_.\[\]]+)"`)
+
+// candidateFields returns the built-in query fields followed by the valid
+// EXTRA_GPU_FIELDS. Extra names are checked against --help-query-gpu the
+// first time; unknown ones are logged and skipped.
+func (b *smiBackend) candidateFields() []gpuField {
+	if b.candidates != nil {
+		return b.candidates
+	}
+	fields := slices.Clip(gpuFields)
+	if len(b.extraFields) > 0 {
+		out, err := b.run("--help-query-gpu")
+		if err != nil {
+			// Try again next poll rather than dropping every extra field.
+			return fields
+		}
+		known := make(map[string]bool)
+		for _, m := range helpQueryFieldRe.FindAllStringSubmatch(string(out), -1) {
+			known[m[1]] = true
+		}
+		for _, name := range b.extraFields {
+			if !known[name] {
+				log.Printf("EXTRA_GPU_FIELDS: %q is not a --query-gpu field, ignoring it", name)
+				continue
+			}
+			if slices.ContainsFunc(fields, func(f gpuField) bool { return f.name == name }) {
+				continue
+			}
+			fields = append(fields, extraGPUField(name))
+		}
+	}
+	b.candidates = fields
+	return fields
+}
+
+// extraGPUField stores a raw field value in GPUInfo.Extra.
+func extraGPUField(name string) gpuField {
+	return gpuField{name: name, set: func(g *GPUInfo, v string) {
+		if g.Extra == nil {
+			g.Extra = make(map[string]string)
+		}
+		g.Extra[name] = v
+	}}
+}
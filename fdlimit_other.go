@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+func fdLimits() (soft, hard uint64, ok bool) {
+	return 0, 0, false
+}
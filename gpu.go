@@ -1,75 +1,155 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
-type GPUProcess struct {
-	PID         int    `json:"pid"`
-	ProcessName string `json:"process_name"`
-	UsedMemory  int    `json:"used_memory_mib"`
-}
-
-type GPUInfo struct {
-	Index             int          `json:"index"`
-	Name              string       `json:"name"`
-	UUID              string       `json:"uuid"`
-	DriverVersion     string       `json:"driver_version"`
-	TemperatureC      int          `json:"temperature_c"`
-	FanSpeedPct       int          `json:"fan_speed_pct"`
-	PowerDrawW        float64      `json:"power_draw_w"`
-	PowerLimitW       float64      `json:"power_limit_w"`
-	MemoryUsedMiB     int          `json:"memory_used_mib"`
-	MemoryTotalMiB    int          `json:"memory_total_mib"`
-	MemoryFreeMiB     int          `json:"memory_free_mib"`
-	GPUUtilizationPct int          `json:"gpu_utilization_pct"`
-	MemUtilizationPct int          `json:"mem_utilization_pct"`
-	PState            string       `json:"pstate"`
-	PCIEGenCurrent    int          `json:"pcie_gen_current"`
-	PCIEGenMax        int          `json:"pcie_gen_max"`
-	Processes         []GPUProcess `json:"processes"`
-}
-
-type GPUMetrics struct {
-	Timestamp string    `json:"timestamp"`
-	GPUs      []GPUInfo `json:"gpus"`
+type GPUMonitor struct {
+	refresh  singleflight.Group // coalesces concurrent Refresh calls
+	pollMu   sync.Mutex         // serializes polls; guards lastPoll
+	lastPoll time.Time
+
+	mu       sync.RWMutex
+	latest   *GPUMetrics
+	latestAt time.Time
+	lastErr  error
+	updated  chan struct{} // closed and replaced whenever latest changes
+	stopCh   chan struct{}
+
+	backend gpuBackend  // source of GPU snapshots
+	smi     *smiBackend // for nvidia-smi queries outside the poll loop
+	mock    bool        // serve synthetic data instead of running nvidia-smi
+
+	interval  time.Duration
+	jitter    float64 // POLL_JITTER; see pollEvery
+	retention time.Duration
+	history   *gpuHistory
+	store     *historyStore // nil unless PERSIST_HISTORY=true
+
+	trendWindow    time.Duration
+	trendThreshold float64 // MiB per minute
+
+	seen         map[string]*MissingGPU // every GPU ever reported, by UUID; guarded by pollMu
+	lastXIDCheck time.Time              // last dmesg read for missing GPUs; guarded by pollMu
+
+	safety *safetyWatchdog // nil unless SAFETY_ENABLE=true; guarded by pollMu
+
+	smoothingAlpha float64
+	ema            map[string]emaState // by UUID; guarded by pollMu
+
+	coolingTempC  int // CoolingSuspect above this temperature...
+	coolingMinFan int // ...with the fan below this percentage
+
+	sampler   *burstSampler       // nil unless GPU_SAMPLE_INTERVAL is set
+	highlight *processHighlighter // nil unless HIGHLIGHT_PROCESSES is set
+	alerts    *gpuAlerts          // guarded by pollMu
+
+	counters *counters
+	mapping  *gpuMapping // UUID to index; saved under DATA_DIR with PERSIST_HISTORY
+
+	lastParseReport time.Time
+	lastSlowWarning time.Time
+
+	versionsMu   sync.Mutex // guards driver and cuda, cached by Versions
+	driver, cuda string
 }
 
-type GPUMonitor struct {
-	mu      sync.RWMutex
-	latest  *GPUMetrics
-	stopCh  chan struct{}
+// gpuBackend produces GPU snapshots for the monitor to poll.
+type gpuBackend interface {
+	fetch() (*GPUMetrics, error)
+}
+
+// NewGPUMonitor selects a backend from GPU_BACKEND ("nvidia-smi" or
+// "dcgm"); MOCK=true overrides it with synthetic data.
+func NewGPUMonitor(cfg *Config) *GPUMonitor {
+	smi := newSMIBackend(cfg)
+	m := &GPUMonitor{
+		updated:   make(chan struct{}),
+		stopCh:    make(chan struct{}),
+		backend:   smi,
+		smi:       smi,
+		mock:      cfg.Mock,
+		interval:  1 * time.Second,
+		jitter:    cfg.PollJitter,
+		retention: cfg.HistoryRetention,
+
+		trendWindow:    cfg.MemoryTrendWindow,
+		trendThreshold: cfg.MemoryTrendThreshold,
+		safety:         newSafetyWatchdog(),
+		smoothingAlpha: cfg.SmoothingAlpha,
+		coolingTempC:   cfg.CoolingTempC,
+		coolingMinFan:  cfg.CoolingMinFanPct,
+		counters:       newCounters(),
+		alerts:         newGPUAlerts(),
+		highlight:      newProcessHighlighter(),
+	}
+	m.history = newGPUHistory(int(m.retention / m.interval))
+	if cfg.PersistHistory {
+		m.openStore(int64(cfg.PersistMaxBytes), cfg.PersistInterval)
+		m.mapping = newGPUMapping(dataDir())
+	} else {
+		m.mapping = newGPUMapping("")
+	}
+	switch {
+	case m.mock:
+		m.backend = mockBackend{}
+	case cfg.GPUBackend == "dcgm":
+		m.backend = newDCGMBackend()
+	}
+	if period := cfg.GPUSampleInterval; period > 0 && m.backend == m.smi {
+		m.sampler = newBurstSampler(smi.gpuIDs, max(period, 10*time.Millisecond))
+	}
+	return m
 }
 
-func NewGPUMonitor() *GPUMonitor {
-	return &GPUMonitor{
-		stopCh: make(chan struct{}),
+// openStore opens the on-disk history under DATA_DIR and reloads its
+// recent tail into the history buffer.
+func (m *GPUMonitor) openStore(maxBytes int64, interval time.Duration) {
+	dir := dataDir()
+	store, err := newHistoryStore(dir, maxBytes, interval)
+	if err != nil {
+		log.Println("history persistence disabled:", err)
+		return
 	}
+	samples := store.load(time.Now().Add(-m.retention))
+	for _, s := range samples {
+		m.history.add(s.Time, s.Metrics)
+	}
+	log.Printf("history: loaded %d samples from %s", len(samples), dir)
+	m.store = store
 }
 
 func (m *GPUMonitor) Start() {
+	if m.sampler != nil {
+		go m.sampler.run(m.stopCh)
+	}
 	m.poll()
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				m.poll()
-			case <-m.stopCh:
-				return
-			}
-		}
-	}()
+	go pollEvery(m.interval, m.jitter, m.stopCh, m.poll)
 }
 
 func (m *GPUMonitor) Stop() {
 	close(m.stopCh)
+	if m.store != nil {
+		m.store.Close()
+	}
 }
 
 func (m *GPUMonitor) Latest() *GPUMetrics {
@@ -78,24 +158,278 @@ func (m *GPUMonitor) Latest() *GPUMetrics {
 	return m.latest
 }
 
+// WaitNewer returns the latest snapshot once its timestamp is after since,
+// blocking until a poll produces one. It returns nil if ctx ends first.
+func (m *GPUMonitor) WaitNewer(ctx context.Context, since time.Time) *GPUMetrics {
+	for {
+		m.mu.RLock()
+		latest, updated := m.latest, m.updated
+		m.mu.RUnlock()
+		if latest != nil {
+			if ts, err := time.Parse(time.RFC3339, latest.Timestamp); err == nil && ts.After(since) {
+				return latest
+			}
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Err returns the error from the most recent poll, or nil if it succeeded.
+// nvidia-smi failures are *SMIError.
+func (m *GPUMonitor) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastErr
+}
+
+// staleIntervals is how many poll intervals old the latest snapshot may
+// get while polls fail before Current stops returning it.
+const staleIntervals = 3
+
+// Current returns the latest snapshot to serve, and the error of the last
+// poll if it failed. While polls fail the snapshot is a copy marked Stale;
+// once it is more than staleIntervals polls old it is nil, so the error is
+// reported instead of old data.
+func (m *GPUMonitor) Current() (*GPUMetrics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.latest == nil || m.lastErr == nil {
+		return m.latest, m.lastErr
+	}
+	if time.Since(m.latestAt) > staleIntervals*m.interval {
+		return nil, m.lastErr
+	}
+	stale := *m.latest
+	stale.Stale = true
+	stale.StaleReason = reasonUnknown
+	var smiErr *SMIError
+	if errors.As(m.lastErr, &smiErr) {
+		stale.StaleReason = smiErr.Reason
+	}
+	return &stale, m.lastErr
+}
+
 func (m *GPUMonitor) poll() {
-	metrics, err := fetchGPUMetrics()
+	m.pollMu.Lock()
+	defer m.pollMu.Unlock()
+	m.pollLocked()
+}
+
+// Refresh polls nvidia-smi now, unless the last poll started less than
+// minAge before the call, and returns the resulting snapshot and poll
+// error. Concurrent callers share a single poll.
+func (m *GPUMonitor) Refresh(minAge time.Duration) (*GPUMetrics, error) {
+	oldest := time.Now().Add(-minAge)
+	m.refresh.Do("poll", func() (any, error) {
+		m.pollMu.Lock()
+		defer m.pollMu.Unlock()
+		if m.lastPoll.Before(oldest) {
+			m.pollLocked()
+		}
+		return nil, nil
+	})
+	// As in OllamaMonitor.Refresh, don't settle for a shared poll that
+	// started before this call allows.
+	m.pollMu.Lock()
+	if m.lastPoll.Before(oldest) {
+		m.pollLocked()
+	}
+	m.pollMu.Unlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest, m.lastErr
+}
+
+func (m *GPUMonitor) pollLocked() {
+	m.lastPoll = time.Now()
+	metrics, err := m.fetchGPUMetrics()
+	took := time.Since(m.lastPoll)
+	warnSlowPoll(&m.lastSlowWarning, "gpu", took, m.interval)
 	if err != nil {
-		fmt.Println("nvidia-smi error:", err)
+		fmt.Println("gpu poll error:", err)
+		m.mu.Lock()
+		m.lastErr = err
+		m.mu.Unlock()
 		return
 	}
+	metrics.QueryDurationMs = durationMs(took)
+	metrics.SchemaVersion = schemaVersion
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		g.UtilPerWatt = utilPerWatt(g.GPUUtilizationPct, g.PowerDrawW)
+		g.PStateLevel = pstateLevel(g.PState)
+		g.Specs = specsFor(g.Name)
+		g.PersistenceAdvisory = persistenceAdvisory(*g)
+		g.CoolingSuspect = g.HasFan && g.TemperatureC > m.coolingTempC && g.FanSpeedPct < m.coolingMinFan
+	}
+	metrics.SpecsTotal = totalSpecs(metrics.GPUs)
+	if m.highlight != nil {
+		m.highlight.apply(metrics)
+	}
+	m.applyPeaks(metrics)
+	m.applySmoothing(metrics)
+	now := time.Now()
+	m.applyMemoryTrend(now, metrics)
+	m.trackMissing(now, metrics)
+	m.alerts.apply(metrics)
+	m.counters.add(now, metrics)
+	m.mapping.observe(metrics)
+	if m.safety != nil {
+		m.safety.check(metrics)
+	}
+
 	m.mu.Lock()
 	m.latest = metrics
+	m.latestAt = now
+	m.lastErr = nil
+	close(m.updated)
+	m.updated = make(chan struct{})
 	m.mu.Unlock()
+
+	m.history.add(now, metrics)
+	if m.store != nil {
+		m.store.maybeAppend(now, metrics)
+	}
+
+	m.reportParseErrors()
+}
+
+// reportParseErrors logs, at most once per parseReportInterval, how many
+// fields failed to parse. A burst usually means nvidia-smi changed its
+// output format and the dashboard is quietly showing zeros.
+func (m *GPUMonitor) reportParseErrors() {
+	if time.Since(m.lastParseReport) < parseReportInterval {
+		return
+	}
+	if n := parseErrors.Swap(0); n > 0 {
+		sample, _ := parseErrorSample.Load().(string)
+		log.Printf("nvidia-smi: %d fields failed to parse in the last %s (e.g. %q)", n, parseReportInterval, sample)
+		m.lastParseReport = time.Now()
+	}
 }
 
-func fetchGPUMetrics() (*GPUMetrics, error) {
-	gpus, err := queryGPUs()
+// slowPollFraction is the share of the poll interval a poll may take
+// before it is logged: beyond it, polls start to queue behind each other.
+const slowPollFraction = 0.8
+
+// warnSlowPoll logs, at most once per parseReportInterval, that a poll of
+// what took close to or longer than its interval.
+func warnSlowPoll(last *time.Time, what string, took, interval time.Duration) {
+	if float64(took) < slowPollFraction*float64(interval) || time.Since(*last) < parseReportInterval {
+		return
+	}
+	log.Printf("%s poll took %s of its %s interval; polls may start to overlap", what, took.Round(time.Millisecond), interval)
+	*last = time.Now()
+}
+
+// pollEvery calls poll every interval until stop is closed. Each wait is
+// lengthened or shortened at random by up to jitter times the interval,
+// so monitors started together across a fleet drift apart instead of
+// hitting nvidia-smi and a shared Ollama host in lockstep. math/rand/v2
+// is seeded per process.
+func pollEvery(interval time.Duration, jitter float64, stop <-chan struct{}, poll func()) {
+	next := time.Now()
+	for {
+		next = next.Add(jittered(interval, jitter))
+		if now := time.Now(); next.Before(now) {
+			next = now // the last poll overran; don't try to catch up
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			poll()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func jittered(d time.Duration, jitter float64) time.Duration {
+	return time.Duration(float64(d) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (m *GPUMonitor) fetchGPUMetrics() (*GPUMetrics, error) {
+	return m.backend.fetch()
+}
+
+// smiBackend reads GPU metrics by running nvidia-smi.
+type smiBackend struct {
+	gpuIDs        string   // passed to nvidia-smi --id when set
+	containerMode bool     // never consult /proc for process details
+	processUtil   bool     // run nvidia-smi pmon for per-process utilization
+	extraFields   []string // EXTRA_GPU_FIELDS
+
+	// exec runs nvidia-smi, normally runSMI. Swapping it for canned
+	// output lets the query and parsing path run, and be benchmarked,
+	// without a GPU.
+	exec func(args ...string) ([]byte, error)
+
+	candidates  []gpuField          // built-in plus valid extra fields; see candidateFields
+	fields      []gpuField          // supported --query-gpu fields; nil until a query fails
+	vgpus       map[string]VGPUInfo // by GPU UUID; see vgpuInfo
+	vgpuChecked time.Time
+
+	// perGPUFields holds the supported fields by GPU index when they
+	// differ between GPUs; nil if one query covers all of them.
+	perGPUFields map[string][]gpuField
+
+	nvlinks       map[string][]NVLinkInfo // by GPU UUID; see nvlinkInfo
+	nvlinkChecked time.Time
+	noNVLink      bool // nvlink --status succeeded and listed no links
+
+	remaps       map[string]RowRemapInfo // by GPU UUID; see rowRemapInfo
+	remapChecked time.Time
+
+	// useXML selects the single-call -q -x strategy; see smixml.go.
+	useXML             bool
+	xmlCaps            map[string]string // compute capability by UUID
+	xmlCapsUnsupported bool
+
+	rawMu    sync.Mutex
+	rawGPUs  rawOutput // last --query-gpu (or -q -x) output
+	rawProcs rawOutput // last --query-compute-apps output
+}
+
+func newSMIBackend(cfg *Config) *smiBackend {
+	return &smiBackend{
+		gpuIDs:        cfg.GPUIDs,
+		containerMode: cfg.ContainerMode,
+		processUtil:   cfg.GPUProcessUtil,
+		extraFields:   cfg.ExtraGPUFields,
+		useXML:        cfg.SMIStrategy == "xml",
+		exec:          runSMI,
+	}
+}
+
+// query returns the GPUs and their processes using the configured
+// strategy.
+func (b *smiBackend) query() ([]GPUInfo, []procWithUUID, error) {
+	if b.useXML {
+		return b.queryXML()
+	}
+	gpus, err := b.queryGPUs()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	procs, err := b.queryProcesses()
+	if err != nil {
+		return nil, nil, err
+	}
+	return gpus, procs, nil
+}
 
-	procs, err := queryProcesses()
+func (b *smiBackend) fetch() (*GPUMetrics, error) {
+	gpus, procs, err := b.query()
 	if err != nil {
 		return nil, err
 	}
@@ -111,65 +445,472 @@ func fetchGPUMetrics() (*GPUMetrics, error) {
 		} else {
 			gpus[i].Processes = []GPUProcess{}
 		}
+		gpus[i].MemoryReservedMiB = memoryReserved(gpus[i])
+	}
+
+	vgpus := b.vgpuInfo()
+	for i := range gpus {
+		if v, ok := vgpus[gpus[i].UUID]; ok {
+			gpus[i].VGPU = &v
+		}
+	}
+
+	nvlinks := b.nvlinkInfo()
+	for i := range gpus {
+		gpus[i].NVLink = nvlinks[gpus[i].UUID]
+	}
+
+	remaps := b.rowRemapInfo()
+	for i := range gpus {
+		if r, ok := remaps[gpus[i].UUID]; ok {
+			gpus[i].RowRemapping = &r
+		}
+	}
+
+	if b.processUtil {
+		// pmon is best-effort: a failure only loses the utilization columns.
+		if util, err := b.queryProcessUtil(); err != nil {
+			log.Println("nvidia-smi pmon:", err)
+		} else {
+			for i := range gpus {
+				for j := range gpus[i].Processes {
+					u := util[pmonKey{gpus[i].Index, gpus[i].Processes[j].PID}]
+					gpus[i].Processes[j].SMUtilPct = u.sm
+					gpus[i].Processes[j].MemUtilPct = u.mem
+				}
+			}
+		}
+	}
+
+	limited := b.containerMode || !pidsVisible(procs)
+	if !limited {
+		for i := range gpus {
+			for j := range gpus[i].Processes {
+				p := &gpus[i].Processes[j]
+				p.CgroupPath, p.ContainerID, p.PodUID = processCgroup(p.PID)
+				if path := processExePath(p.PID); path != "" && path != p.ProcessName {
+					p.ProcessNameShort, p.ProcessName = p.ProcessName, path
+				}
+			}
+		}
 	}
 
 	return &GPUMetrics{
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		GPUs:      gpus,
+		Timestamp:          time.Now().UTC().Format(time.RFC3339),
+		GPUs:               gpus,
+		ProcessInfoLimited: limited,
 	}, nil
 }
 
+// Versions returns the NVIDIA driver and CUDA versions reported by
+// nvidia-smi, falling back to the last polled driver version. With
+// GPU_BACKEND=dcgm only the polled driver version is known. The versions
+// nvidia-smi first reports are cached, so a driver upgrade shows after a
+// restart.
+func (m *GPUMonitor) Versions() (driver, cuda string) {
+	if m.mock {
+		return "550.54.14", "12.4"
+	}
+	m.versionsMu.Lock()
+	defer m.versionsMu.Unlock()
+	if m.driver != "" {
+		return m.driver, m.cuda
+	}
+	if m.backend == m.smi {
+		if out, err := m.smi.run(); err == nil {
+			driver, cuda = parseSMIHeader(out)
+			m.driver, m.cuda = driver, cuda
+		}
+	}
+	if latest := m.Latest(); driver == "" && latest != nil && len(latest.GPUs) > 0 {
+		driver = latest.GPUs[0].DriverVersion
+	}
+	return driver, cuda
+}
+
+// run runs nvidia-smi with args, scoped to the configured GPU IDs.
+func (b *smiBackend) run(args ...string) ([]byte, error) {
+	if b.gpuIDs != "" {
+		args = append([]string{"--id=" + b.gpuIDs}, args...)
+	}
+	return b.exec(args...)
+}
+
+// runSubcommand runs an nvidia-smi subcommand such as pmon or nvlink,
+// scoped to the configured GPU IDs. Subcommands take -i after their name;
+// nvidia-smi rejects a leading --id.
+func (b *smiBackend) runSubcommand(cmd string, args ...string) ([]byte, error) {
+	if b.gpuIDs != "" {
+		args = append([]string{"-i", b.gpuIDs}, args...)
+	}
+	return b.exec(append([]string{cmd}, args...)...)
+}
+
+// runSMI runs nvidia-smi with args in the C locale. Failures are returned
+// as *SMIError.
+func runSMI(args ...string) ([]byte, error) {
+	cmd := exec.Command("nvidia-smi", args...)
+	// Force the C locale: some locales print "250,5" for floats, which
+	// breaks both number parsing and the ", " field split.
+	cmd.Env = append(os.Environ(), "LC_ALL=C", "LANG=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return out, classifySMIError(err, out)
+	}
+	return out, nil
+}
+
+// processExePath returns the full executable path of pid from
+// /proc/<pid>/exe, falling back to the first word of its command line, or
+// "" if neither is readable.
+func processExePath(pid int) string {
+	if path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return strings.TrimSuffix(path, " (deleted)")
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	argv0, _, _ := strings.Cut(string(cmdline), "\x00")
+	return argv0
+}
+
+// pidsVisible reports whether every process PID can be found in our
+// /proc with a matching command name. nvidia-smi reports host PIDs, which
+// inside a container either don't exist or belong to unrelated processes.
+func pidsVisible(procs []procWithUUID) bool {
+	for _, p := range procs {
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", p.proc.PID))
+		if err != nil {
+			return false
+		}
+		name := strings.TrimSpace(string(comm))
+		if name == "" || !strings.HasPrefix(filepath.Base(p.proc.ProcessName), name) {
+			return false
+		}
+	}
+	return true
+}
+
 type procWithUUID struct {
 	uuid string
 	proc GPUProcess
 }
 
-func queryGPUs() ([]GPUInfo, error) {
-	out, err := exec.Command("nvidia-smi",
-		"--query-gpu=index,name,uuid,driver_version,temperature.gpu,fan.speed,power.draw,power.limit,memory.used,memory.total,memory.free,utilization.gpu,utilization.memory,pstate,pcie.link.gen.current,pcie.link.gen.max",
-		"--format=csv,noheader,nounits",
-	).Output()
+// gpuField is one --query-gpu column and how it is stored in GPUInfo.
+type gpuField struct {
+	name     string
+	required bool // the query is useless without it
+	set      func(g *GPUInfo, v string)
+}
+
+var gpuFields = []gpuField{
+	{"index", true, func(g *GPUInfo, v string) { g.Index = parseInt(v) }},
+	{"name", false, func(g *GPUInfo, v string) { g.Name = v }},
+	{"uuid", true, func(g *GPUInfo, v string) { g.UUID = v }},
+	{"pci.bus_id", false, func(g *GPUInfo, v string) {
+		if available(v) {
+			g.PCIBusID = v
+		}
+	}},
+	{"driver_version", false, func(g *GPUInfo, v string) { g.DriverVersion = v }},
+	{"persistence_mode", false, func(g *GPUInfo, v string) { g.PersistenceMode = persistenceMode(v) }},
+	{"temperature.gpu", false, func(g *GPUInfo, v string) {
+		g.TemperatureC, g.TemperatureAvailable = parseInt(v), available(v)
+	}},
+	{"fan.speed", false, func(g *GPUInfo, v string) {
+		// Passively cooled cards (A100, H100, ...) report [N/A].
+		g.FanSpeedPct, g.HasFan = parseInt(v), available(v)
+	}},
+	{"power.draw", false, func(g *GPUInfo, v string) {
+		g.PowerDrawW, g.PowerDrawAvailable = parseFloat(v), available(v)
+	}},
+	{"power.limit", false, func(g *GPUInfo, v string) {
+		g.PowerLimitW, g.PowerLimitAvailable = parseFloat(v), available(v)
+	}},
+	{"memory.used", false, func(g *GPUInfo, v string) { g.MemoryUsedMiB = parseInt(v) }},
+	{"memory.total", false, func(g *GPUInfo, v string) { g.MemoryTotalMiB = parseInt(v) }},
+	{"memory.free", false, func(g *GPUInfo, v string) { g.MemoryFreeMiB = parseInt(v) }},
+	{"utilization.gpu", false, func(g *GPUInfo, v string) {
+		g.GPUUtilizationPct, g.GPUUtilizationAvailable = parseInt(v), available(v)
+	}},
+	{"utilization.memory", false, func(g *GPUInfo, v string) {
+		g.MemUtilizationPct, g.MemUtilizationAvailable = parseInt(v), available(v)
+	}},
+	{"pstate", false, func(g *GPUInfo, v string) { g.PState = v }},
+	{"pcie.link.gen.current", false, func(g *GPUInfo, v string) { g.PCIEGenCurrent = parseInt(v) }},
+	{"pcie.link.gen.max", false, func(g *GPUInfo, v string) { g.PCIEGenMax = parseInt(v) }},
+	{"compute_cap", false, func(g *GPUInfo, v string) {
+		g.ComputeCapability = v
+		g.Architecture = architectureName(v)
+	}},
+}
+
+func (b *smiBackend) queryGPUs() ([]GPUInfo, error) {
+	if b.perGPUFields != nil {
+		return b.queryGPUsPerIndex()
+	}
+	fields := b.fields
+	if fields == nil {
+		fields = b.candidateFields()
+	}
+	out, err := b.runGPUQuery("", fields)
+	if err != nil && b.fields == nil {
+		// Older drivers reject the whole query if any field is unknown.
+		// Work out once which fields this driver supports and retry.
+		var smiErr *SMIError
+		if !errors.As(err, &smiErr) || smiErr.Reason != reasonUnknown {
+			return nil, fmt.Errorf("query-gpu: %w", err)
+		}
+		perGPU := b.supportedFieldsPerGPU()
+		if len(perGPU) == 0 {
+			return nil, fmt.Errorf("query-gpu: %w", err)
+		}
+		if fields = sameFields(perGPU); fields == nil {
+			// GPUs of different generations support different fields, so
+			// query each GPU with its own.
+			b.perGPUFields = perGPU
+			return b.queryGPUsPerIndex()
+		}
+		b.fields = fields
+		out, err = b.runGPUQuery("", fields)
+	}
+	b.recordRaw(&b.rawGPUs, gpuQueryArgs("", fields), out)
 	if err != nil {
 		return nil, fmt.Errorf("query-gpu: %w", err)
 	}
+	return parseGPUQuery(out, fields), nil
+}
+
+// queryGPUsPerIndex runs one --query-gpu per GPU with the fields that GPU
+// supports. A GPU whose query fails is logged and left out, so the others
+// are still reported and the failed one shows up in missing_gpus. When
+// the GPUs listed no longer match perGPUFields (one was removed, added or
+// replaced), the supported fields are worked out again.
+func (b *smiBackend) queryGPUsPerIndex() ([]GPUInfo, error) {
+	out, err := b.runGPUQuery("", []gpuField{gpuFields[0]})
+	if err != nil {
+		return nil, fmt.Errorf("query-gpu: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	slices.Sort(ids)
+	if !slices.Equal(ids, slices.Sorted(maps.Keys(b.perGPUFields))) {
+		log.Printf("nvidia-smi: GPU indexes changed to %s; checking supported fields again", strings.Join(ids, ","))
+		b.perGPUFields, b.fields = nil, nil
+		return b.queryGPUs()
+	}
+
+	var gpus []GPUInfo
+	var lastErr error
+	var raw bytes.Buffer
+	for _, id := range ids {
+		fields := b.perGPUFields[id]
+		out, err := b.runGPUQuery(id, fields)
+		fmt.Fprintf(&raw, "# nvidia-smi %s\n%s", strings.Join(gpuQueryArgs(id, fields), " "), out)
+		if err != nil {
+			log.Printf("nvidia-smi: query-gpu --id=%s: %v", id, err)
+			lastErr = fmt.Errorf("query-gpu --id=%s: %w", id, err)
+			continue
+		}
+		gpus = append(gpus, parseGPUQuery(out, fields)...)
+	}
+	b.recordRaw(&b.rawGPUs, []string{"--id=" + strings.Join(ids, ","), "--query-gpu (one query per GPU)"}, raw.Bytes())
+	if len(gpus) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	slices.SortFunc(gpus, func(a, b GPUInfo) int { return a.Index - b.Index })
+	return gpus, nil
+}
 
+func parseGPUQuery(out []byte, fields []gpuField) []GPUInfo {
 	var gpus []GPUInfo
 	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
-		fields := strings.Split(line, ", ")
-		if len(fields) < 16 {
+		values := strings.Split(line, ", ")
+		if len(values) < len(fields) {
 			continue
 		}
-		gpus = append(gpus, GPUInfo{
-			Index:             parseInt(fields[0]),
-			Name:              fields[1],
-			UUID:              fields[2],
-			DriverVersion:     fields[3],
-			TemperatureC:      parseInt(fields[4]),
-			FanSpeedPct:       parseInt(fields[5]),
-			PowerDrawW:        parseFloat(fields[6]),
-			PowerLimitW:       parseFloat(fields[7]),
-			MemoryUsedMiB:     parseInt(fields[8]),
-			MemoryTotalMiB:    parseInt(fields[9]),
-			MemoryFreeMiB:     parseInt(fields[10]),
-			GPUUtilizationPct: parseInt(fields[11]),
-			MemUtilizationPct: parseInt(fields[12]),
-			PState:            fields[13],
-			PCIEGenCurrent:    parseInt(fields[14]),
-			PCIEGenMax:        parseInt(fields[15]),
-		})
+		var g GPUInfo
+		for i, f := range fields {
+			f.set(&g, values[i])
+		}
+		gpus = append(gpus, g)
 	}
-	return gpus, nil
+	return gpus
+}
+
+// runGPUQuery runs --query-gpu for fields, on the GPU with index id or, if
+// id is empty, on all configured GPUs. It doesn't record the output for
+// /api/debug/nvidia-smi, since field probes go through it too; the poll
+// does.
+func (b *smiBackend) runGPUQuery(id string, fields []gpuField) ([]byte, error) {
+	if id == "" {
+		return b.run(gpuQueryArgs("", fields)...)
+	}
+	return b.exec(gpuQueryArgs(id, fields)...)
+}
+
+func gpuQueryArgs(id string, fields []gpuField) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	args := []string{"--query-gpu=" + strings.Join(names, ","), "--format=csv,noheader,nounits"}
+	if id != "" {
+		args = append([]string{"--id=" + id}, args...)
+	}
+	return args
+}
+
+// supportedFieldsPerGPU works out the supported fields of each GPU, keyed
+// by index. It returns nil if the GPUs can't be listed or a required field
+// is rejected, since then the failure isn't about field support.
+func (b *smiBackend) supportedFieldsPerGPU() map[string][]gpuField {
+	out, err := b.runGPUQuery("", []gpuField{gpuFields[0]})
+	if err != nil {
+		return nil
+	}
+	perGPU := make(map[string][]gpuField)
+	for _, id := range strings.Fields(string(out)) {
+		fields := b.supportedGPUFields(id)
+		if fields == nil {
+			return nil
+		}
+		perGPU[id] = fields
+	}
+	return perGPU
+}
+
+// sameFields returns the field list shared by every GPU in perGPU, or nil
+// if they differ.
+func sameFields(perGPU map[string][]gpuField) []gpuField {
+	var shared []gpuField
+	for _, fields := range perGPU {
+		if shared == nil {
+			shared = fields
+			continue
+		}
+		if !slices.EqualFunc(shared, fields, func(a, b gpuField) bool { return a.name == b.name }) {
+			return nil
+		}
+	}
+	return shared
+}
+
+// supportedGPUFields queries each field on its own on GPU id and returns
+// those it accepts, logging the rest. It returns nil if a required field
+// is rejected.
+func (b *smiBackend) supportedGPUFields(id string) []gpuField {
+	var supported []gpuField
+	var dropped []string
+	for _, f := range b.candidateFields() {
+		if _, err := b.runGPUQuery(id, []gpuField{f}); err != nil {
+			if f.required {
+				return nil
+			}
+			dropped = append(dropped, f.name)
+			continue
+		}
+		supported = append(supported, f)
+	}
+	if len(dropped) > 0 {
+		log.Printf("nvidia-smi does not support %s on GPU %s; reporting them as zero", strings.Join(dropped, ", "), id)
+	}
+	return supported
+}
+
+// utilPerWatt returns utilization percent per watt, rounded to three
+// decimals. It is 0 for an idle GPU or when power draw isn't reported.
+func utilPerWatt(utilPct int, watts float64) float64 {
+	if utilPct <= 0 || watts <= 0 {
+		return 0
+	}
+	return math.Round(float64(utilPct)/watts*1000) / 1000
+}
+
+// persistenceMode normalizes nvidia-smi's "Enabled"/"Disabled".
+func persistenceMode(v string) string {
+	v = strings.TrimSpace(v)
+	if isNA(v) {
+		return ""
+	}
+	return strings.ToLower(v)
+}
+
+// persistenceAdvisory suggests persistence mode for an idle GPU that has
+// it off. Without it the driver unloads when the last client exits, so
+// every job pays the driver initialization again.
+func persistenceAdvisory(g GPUInfo) string {
+	if g.PersistenceMode != "disabled" || g.GPUUtilizationPct > 0 || len(g.Processes) > 0 {
+		return ""
+	}
+	return fmt.Sprintf("persistence mode is off on this idle GPU (drawing %.1f W); enabling it (nvidia-smi -pm 1) avoids reinitializing the driver for every job", g.PowerDrawW)
+}
+
+// memoryReserved is the part of a GPU's used memory not attributable to
+// any of its listed processes: driver and context overhead, plus processes
+// nvidia-smi can't see. It is never negative.
+func memoryReserved(g GPUInfo) int {
+	reserved := g.MemoryUsedMiB
+	for _, p := range g.Processes {
+		reserved -= p.UsedMemoryMiB
+	}
+	return max(reserved, 0)
+}
+
+// pstateLevel parses a performance state like "P2" into 2, or returns -1
+// for anything else, including nvidia-smi's "Unknown".
+func pstateLevel(pstate string) int {
+	digits, ok := strings.CutPrefix(strings.TrimSpace(pstate), "P")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || n > 15 {
+		return -1
+	}
+	return n
 }
 
-func queryProcesses() ([]procWithUUID, error) {
-	out, err := exec.Command("nvidia-smi",
+// architectureName maps a CUDA compute capability ("8.6") to the NVIDIA
+// architecture that introduced it.
+func architectureName(computeCap string) string {
+	major, minor, _ := strings.Cut(computeCap, ".")
+	switch major {
+	case "3":
+		return "Kepler"
+	case "5":
+		return "Maxwell"
+	case "6":
+		return "Pascal"
+	case "7":
+		if minor == "5" {
+			return "Turing"
+		}
+		return "Volta"
+	case "8":
+		if minor == "9" {
+			return "Ada"
+		}
+		return "Ampere"
+	case "9":
+		return "Hopper"
+	case "10", "12":
+		return "Blackwell"
+	}
+	return ""
+}
+
+func (b *smiBackend) queryProcesses() ([]procWithUUID, error) {
+	args := []string{
 		"--query-compute-apps=gpu_uuid,pid,process_name,used_memory",
 		"--format=csv,noheader,nounits",
-	).Output()
+	}
+	out, err := b.run(args...)
+	b.recordRaw(&b.rawProcs, args, out)
 	if err != nil {
 		return nil, fmt.Errorf("query-compute-apps: %w", err)
 	}
@@ -187,29 +928,117 @@ func queryProcesses() ([]procWithUUID, error) {
 		procs = append(procs, procWithUUID{
 			uuid: fields[0],
 			proc: GPUProcess{
-				PID:         parseInt(fields[1]),
-				ProcessName: fields[2],
-				UsedMemory:  parseInt(fields[3]),
+				PID:           parseInt(fields[1]),
+				ProcessName:   fields[2],
+				UsedMemoryMiB: parseInt(fields[3]),
 			},
 		})
 	}
 	return procs, nil
 }
 
-func parseInt(s string) int {
-	s = strings.TrimSpace(s)
-	if s == "[N/A]" || s == "N/A" || s == "" {
+type pmonKey struct {
+	gpu int
+	pid int
+}
+
+type pmonUtil struct {
+	sm  int
+	mem int
+}
+
+// queryProcessUtil takes a single `nvidia-smi pmon` sample of per-process
+// SM and memory utilization, keyed by GPU index and PID.
+func (b *smiBackend) queryProcessUtil() (map[pmonKey]pmonUtil, error) {
+	out, err := b.runSubcommand("pmon", "-c", "1", "-s", "u")
+	if err != nil {
+		return nil, fmt.Errorf("pmon: %w", err)
+	}
+
+	util := make(map[pmonKey]pmonUtil)
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// gpu pid type sm mem enc dec ... command
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[1] == "-" {
+			continue
+		}
+		util[pmonKey{parseInt(fields[0]), parseInt(fields[1])}] = pmonUtil{
+			sm:  pmonInt(fields[3]),
+			mem: pmonInt(fields[4]),
+		}
+	}
+	return util, nil
+}
+
+// pmonInt parses a pmon column, where "-" means no activity.
+func pmonInt(s string) int {
+	if s == "-" {
 		return 0
 	}
-	v, _ := strconv.Atoi(s)
+	return parseInt(s)
+}
+
+const parseReportInterval = time.Minute
+
+var (
+	// parseErrors counts non-N/A values that failed to parse since the last
+	// report; parseErrorSample holds the most recent offending value.
+	parseErrors      atomic.Int64
+	parseErrorSample atomic.Value
+)
+
+// isNA reports whether s is one of nvidia-smi's "no value" placeholders.
+func isNA(s string) bool {
+	switch s {
+	case "", "N/A", "[N/A]", "[Not Supported]":
+		return true
+	}
+	return false
+}
+
+// available reports whether s is an actual value rather than a
+// placeholder.
+func available(s string) bool {
+	return !isNA(strings.TrimSpace(s))
+}
+
+func parseIntErr(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if isNA(s) {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func parseFloatErr(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if isNA(s) {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseInt(s string) int {
+	v, err := parseIntErr(s)
+	if err != nil {
+		recordParseError(s)
+	}
 	return v
 }
 
 func parseFloat(s string) float64 {
-	s = strings.TrimSpace(s)
-	if s == "[N/A]" || s == "N/A" || s == "" {
-		return 0
+	v, err := parseFloatErr(s)
+	if err != nil {
+		recordParseError(s)
 	}
-	v, _ := strconv.ParseFloat(s, 64)
 	return v
 }
+
+func recordParseError(s string) {
+	parseErrors.Add(1)
+	parseErrorSample.Store(s)
+}
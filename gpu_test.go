@@ -0,0 +1,410 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// errExit is what a failed fake nvidia-smi run returns, as exec does.
+var errExit = errors.New("exit status 2")
+
+// fakeSMI stands in for nvidia-smi through smiBackend.exec, answering
+// the queries the poll path makes for a host with gpus identical GPUs.
+type fakeSMI struct {
+	gpus int
+	// unsupported maps a --query-gpu field to the GPU index that rejects
+	// it, as an older card in a mixed host does.
+	unsupported map[string]string
+	// lost is the index of a GPU that is still listed but whose queries
+	// fail, as after it falls off the bus.
+	lost string
+	// driverGone makes every call fail as after the driver is unloaded.
+	driverGone bool
+	// nvlinkDown makes the nvlink subcommand fail.
+	nvlinkDown bool
+	calls      int
+}
+
+func fakeGPUUUID(i int) string {
+	return fmt.Sprintf("GPU-00000000-0000-4000-8000-%012d", i)
+}
+
+func fakeGPUBusID(i int) string {
+	return fmt.Sprintf("00000000:%02X:00.0", 0x17+i)
+}
+
+func fakeGPUValue(field string, i int) string {
+	switch field {
+	case "index":
+		return fmt.Sprint(i)
+	case "name":
+		return "NVIDIA A100-SXM4-80GB"
+	case "uuid":
+		return fakeGPUUUID(i)
+	case "pci.bus_id":
+		return fakeGPUBusID(i)
+	case "driver_version":
+		return "550.54.14"
+	case "persistence_mode":
+		return "Enabled"
+	case "temperature.gpu":
+		return fmt.Sprint(40 + i)
+	case "fan.speed":
+		return "[N/A]"
+	case "power.draw":
+		return fmt.Sprintf("%.2f", 80.5+float64(i))
+	case "power.limit":
+		return "400.00"
+	case "memory.used":
+		return fmt.Sprint(1000 * (i + 1))
+	case "memory.total":
+		return "81920"
+	case "memory.free":
+		return fmt.Sprint(81920 - 1000*(i+1))
+	case "utilization.gpu", "utilization.memory":
+		return fmt.Sprint(10 * (i % 10))
+	case "pstate":
+		return "P0"
+	case "pcie.link.gen.current", "pcie.link.gen.max":
+		return "4"
+	case "compute_cap":
+		return "8.0"
+	}
+	return "[N/A]"
+}
+
+func (f *fakeSMI) exec(args ...string) ([]byte, error) {
+	id := ""
+	if len(args) > 0 && strings.HasPrefix(args[0], "--id=") {
+		id, args = strings.TrimPrefix(args[0], "--id="), args[1:]
+	}
+	if len(args) > 0 && isSMISubcommand(args[0]) {
+		// Like nvidia-smi, only take the GPU ID after the subcommand.
+		if id != "" {
+			return nil, &SMIError{Reason: reasonUnknown, Message: "Invalid combination of input arguments. Please run 'nvidia-smi -h' for help.", Err: errExit}
+		}
+		if i := slices.Index(args, "-i"); i > 0 && i+1 < len(args) {
+			id = args[i+1]
+			args = slices.Delete(slices.Clone(args), i, i+2)
+		}
+	}
+	f.calls++
+	if f.driverGone {
+		return nil, &SMIError{Reason: reasonDriverNotLoaded, Message: "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.", Err: errExit}
+	}
+	var b strings.Builder
+	switch {
+	case len(args) == 0:
+		b.WriteString("| NVIDIA-SMI 550.54.14              Driver Version: 550.54.14      CUDA Version: 12.4     |\n")
+	case args[0] == "nvlink":
+		if f.nvlinkDown {
+			return nil, &SMIError{Reason: reasonUnknown, Message: "Unable to get NVLink status.", Err: errExit}
+		}
+		for i := range f.gpus {
+			if id != "" && id != fmt.Sprint(i) {
+				continue
+			}
+			fmt.Fprintf(&b, "GPU %d: NVIDIA A100-SXM4-80GB (UUID: %s)\n", i, fakeGPUUUID(i))
+			if args[1] == "--status" {
+				b.WriteString("\t Link 0: 25 GB/s\n\t Link 1: <inactive>\n")
+			} else {
+				b.WriteString("\t Link 0: Replay Errors: 0\n\t Link 1: Replay Errors: 0\n")
+			}
+		}
+	case args[0] == "pmon":
+		b.WriteString("# gpu         pid   type     sm    mem    enc    dec    command\n# Idx           #    C/G      %      %      %      %    name\n")
+		for i := range f.gpus {
+			if id == "" || id == fmt.Sprint(i) {
+				fmt.Fprintf(&b, "    %d    %d     C     %d     %d      -      -    python3\n", i, 4000000+i, 40+i, 10+i)
+			}
+		}
+	case strings.HasPrefix(args[0], "--query-gpu="):
+		fields := strings.Split(strings.TrimPrefix(args[0], "--query-gpu="), ",")
+		if id != "" && id == f.lost && len(fields) > 1 {
+			return nil, &SMIError{Reason: reasonUnknown, Message: "Unable to determine the device handle for GPU " + id + ": GPU is lost.", Err: errExit}
+		}
+		for i := range f.gpus {
+			if id != "" && id != fmt.Sprint(i) {
+				continue
+			}
+			values := make([]string, len(fields))
+			for j, field := range fields {
+				if gpu, ok := f.unsupported[field]; ok && gpu == fmt.Sprint(i) {
+					return nil, &SMIError{Reason: reasonUnknown, Message: fmt.Sprintf("Field %q is not a valid field to query.", field), Err: errExit}
+				}
+				values[j] = fakeGPUValue(field, i)
+			}
+			b.WriteString(strings.Join(values, ", ") + "\n")
+		}
+	case strings.HasPrefix(args[0], "--query-compute-apps="):
+		for i := range f.gpus {
+			fmt.Fprintf(&b, "%s, %d, /usr/bin/python3, %d\n", fakeGPUUUID(i), 4000000+i, 900)
+		}
+	case len(args) == 2 && args[0] == "-q" && args[1] == "-x":
+		b.WriteString("<?xml version=\"1.0\" ?>\n<nvidia_smi_log>\n<driver_version>550.54.14</driver_version>\n")
+		for i := range f.gpus {
+			fmt.Fprintf(&b, `<gpu id="%s">
+<product_name>NVIDIA A100-SXM4-80GB</product_name>
+<uuid>%s</uuid>
+<persistence_mode>Enabled</persistence_mode>
+<performance_state>P0</performance_state>
+<fan_speed>N/A</fan_speed>
+<pci><pci_gpu_link_info><pcie_gen><max_link_gen>4</max_link_gen><current_link_gen>4</current_link_gen></pcie_gen></pci_gpu_link_info></pci>
+<fb_memory_usage><total>81920 MiB</total><used>%d MiB</used><free>%d MiB</free></fb_memory_usage>
+<utilization><gpu_util>%d %%</gpu_util><memory_util>%d %%</memory_util></utilization>
+<temperature><gpu_temp>%d C</gpu_temp></temperature>
+<gpu_power_readings><power_draw>%.2f W</power_draw><current_power_limit>400.00 W</current_power_limit></gpu_power_readings>
+<processes><process_info><pid>%d</pid><process_name>/usr/bin/python3</process_name><used_memory>900 MiB</used_memory></process_info></processes>
+</gpu>
+`, fakeGPUBusID(i), fakeGPUUUID(i), 1000*(i+1), 81920-1000*(i+1), 10*(i%10), 10*(i%10), 40+i, 80.5+float64(i), 4000000+i)
+		}
+		b.WriteString("</nvidia_smi_log>\n")
+	}
+	// Everything else (-q for vGPU, nvlink, remapped rows) has nothing to
+	// report on this host.
+	return []byte(b.String()), nil
+}
+
+func isSMISubcommand(arg string) bool {
+	return arg == "pmon" || arg == "nvlink"
+}
+
+// newFakeSMIBackend returns an nvidia-smi backend running against fake.
+func newFakeSMIBackend(fake *fakeSMI, useXML bool) *smiBackend {
+	b := newSMIBackend(defaultConfig())
+	b.exec = fake.exec
+	b.useXML = useXML
+	return b
+}
+
+func TestQueryGPUsPerIndex(t *testing.T) {
+	fake := &fakeSMI{gpus: 4, unsupported: map[string]string{"compute_cap": "3"}}
+	backend := newFakeSMIBackend(fake, false)
+	indexes := func() []int {
+		t.Helper()
+		gpus, err := backend.queryGPUs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var idx []int
+		for _, g := range gpus {
+			idx = append(idx, g.Index)
+		}
+		return idx
+	}
+
+	if got := indexes(); !slices.Equal(got, []int{0, 1, 2, 3}) {
+		t.Fatalf("got GPUs %v, want 0-3", got)
+	}
+	if backend.perGPUFields == nil {
+		t.Fatal("mixed GPUs not queried per index")
+	}
+
+	// A GPU whose query fails is left out; the others are still reported.
+	fake.lost = "1"
+	if got := indexes(); !slices.Equal(got, []int{0, 2, 3}) {
+		t.Errorf("with GPU 1 lost, got GPUs %v, want 0, 2, 3", got)
+	}
+	fake.lost = ""
+
+	// Without GPU 3 the remaining GPUs share their fields again.
+	fake.gpus = 3
+	if got := indexes(); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Errorf("after removing GPU 3, got GPUs %v, want 0-2", got)
+	}
+	if backend.perGPUFields != nil {
+		t.Errorf("still queried per index after the GPUs changed")
+	}
+}
+
+func TestQueryGPUsRecordsPollOnly(t *testing.T) {
+	// Mixed GPUs are listed, probed field by field and then queried one at
+	// a time; /api/debug/nvidia-smi gets every GPU's query, not the last
+	// probe or query.
+	backend := newFakeSMIBackend(&fakeSMI{gpus: 2, unsupported: map[string]string{"compute_cap": "1"}}, false)
+	for range 2 {
+		if _, err := backend.queryGPUs(); err != nil {
+			t.Fatal(err)
+		}
+		raw := string(backend.rawGPUs.out)
+		for i := range 2 {
+			if !strings.Contains(raw, fakeGPUUUID(i)) {
+				t.Errorf("GPU %d missing from recorded output:\n%s", i, raw)
+			}
+		}
+	}
+}
+
+func TestGPUMonitorCurrentStale(t *testing.T) {
+	fake := &fakeSMI{gpus: 2}
+	m := NewGPUMonitor(defaultConfig())
+	m.smi.exec = fake.exec
+	m.poll()
+	if metrics, err := m.Current(); metrics == nil || err != nil || metrics.Stale {
+		t.Fatalf("after a good poll: got %v, %v", metrics, err)
+	}
+
+	fake.driverGone = true
+	m.poll()
+	metrics, err := m.Current()
+	if metrics == nil || !metrics.Stale || metrics.StaleReason != reasonDriverNotLoaded || err == nil {
+		t.Fatalf("after a failed poll: got %+v, %v; want a stale snapshot", metrics, err)
+	}
+	if m.Latest().Stale {
+		t.Error("Current marked the shared snapshot stale")
+	}
+
+	m.latestAt = m.latestAt.Add(-(staleIntervals + 1) * m.interval)
+	if metrics, err := m.Current(); metrics != nil || err == nil {
+		t.Errorf("%d intervals after the last good poll: got %v, %v; want only the error", staleIntervals+1, metrics, err)
+	}
+}
+
+func TestGPUMonitorVersionsCached(t *testing.T) {
+	fake := &fakeSMI{gpus: 1}
+	m := NewGPUMonitor(defaultConfig())
+	m.smi.exec = fake.exec
+	for range 3 {
+		if driver, cuda := m.Versions(); driver != "550.54.14" || cuda != "12.4" {
+			t.Fatalf("got driver %q, CUDA %q", driver, cuda)
+		}
+	}
+	if fake.calls != 1 {
+		t.Errorf("ran nvidia-smi %d times, want 1", fake.calls)
+	}
+}
+
+func TestQueryProcessUtilGPUIDs(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.GPUIDs = "1"
+	b := newSMIBackend(cfg)
+	b.exec = (&fakeSMI{gpus: 2}).exec
+	util, err := b.queryProcessUtil()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[pmonKey]pmonUtil{{1, 4000001}: {sm: 41, mem: 11}}
+	if !maps.Equal(util, want) {
+		t.Errorf("got %v, want %v", util, want)
+	}
+}
+
+func TestNVLinkInfoGPUIDs(t *testing.T) {
+	fake := &fakeSMI{gpus: 2, nvlinkDown: true}
+	cfg := defaultConfig()
+	cfg.GPUIDs = "1"
+	b := newSMIBackend(cfg)
+	b.exec = fake.exec
+	if links := b.nvlinkInfo(); len(links) != 0 {
+		t.Fatalf("got %v with nvlink failing", links)
+	}
+
+	// A failure isn't taken for a host without NVLink.
+	fake.nvlinkDown = false
+	b.nvlinkChecked = b.nvlinkChecked.Add(-nvlinkRefresh)
+	links := b.nvlinkInfo()
+	if len(links) != 1 || len(links[fakeGPUUUID(1)]) != 2 || links[fakeGPUUUID(1)][0].State != "up" {
+		t.Errorf("got %v, want the two links of GPU 1", links)
+	}
+}
+
+func BenchmarkFetchGPUMetrics(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		fake   *fakeSMI
+		useXML bool
+	}{
+		{"csv", &fakeSMI{gpus: 8}, false},
+		{"xml", &fakeSMI{gpus: 8}, true},
+		{"per-index", &fakeSMI{gpus: 8, unsupported: map[string]string{"compute_cap": "7"}}, false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			backend := newFakeSMIBackend(bc.fake, bc.useXML)
+			if _, err := backend.fetch(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				backend.fetch()
+			}
+		})
+	}
+}
+
+// BenchmarkSMIStrategy compares SMI_STRATEGY=csv and xml with the cost of
+// starting a process per nvidia-smi call, by having cat print the canned
+// output. The gap between the two grows with that cost, which is higher
+// for the real nvidia-smi than for cat.
+func BenchmarkSMIStrategy(b *testing.B) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		b.Skip("cat not found")
+	}
+	for _, bc := range []struct {
+		name   string
+		useXML bool
+	}{
+		{"csv", false},
+		{"xml", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			fake := &fakeSMI{gpus: 16}
+			dir := b.TempDir()
+			files := make(map[string]string)
+			backend := newFakeSMIBackend(fake, bc.useXML)
+			backend.exec = func(args ...string) ([]byte, error) {
+				key := strings.Join(args, " ")
+				file, ok := files[key]
+				if !ok {
+					out, err := fake.exec(args...)
+					if err != nil {
+						return nil, err
+					}
+					file = filepath.Join(dir, fmt.Sprint(len(files)))
+					if err := os.WriteFile(file, out, 0o644); err != nil {
+						return nil, err
+					}
+					files[key] = file
+				}
+				return exec.Command(cat, file).Output()
+			}
+			if _, err := backend.fetch(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				backend.fetch()
+			}
+		})
+	}
+}
+
+func BenchmarkParseGPUCSV(b *testing.B) {
+	fake := &fakeSMI{gpus: 8}
+	names := make([]string, len(gpuFields))
+	for i, f := range gpuFields {
+		names[i] = f.name
+	}
+	out, _ := fake.exec("--query-gpu=" + strings.Join(names, ","))
+	b.ReportAllocs()
+	for b.Loop() {
+		parseGPUQuery(out, gpuFields)
+	}
+}
+
+func BenchmarkParseGPUXML(b *testing.B) {
+	out, _ := (&fakeSMI{gpus: 8}).exec("-q", "-x")
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, err := parseSMIXML(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Grafana SimpleJSON datasource (also understood by the Infinity plugin's
+// legacy mode), served under /grafana/: GET / for the connection test,
+// POST /search for metric names and POST /query for timeseries from the
+// in-memory history.
+//
+// A target is either "gpu<index>.<field>", one series, or a bare
+// "<field>", one series per GPU.
+
+// grafanaFields are the GPU fields that can be queried.
+var grafanaFields = map[string]func(GPUInfo) float64{
+	"temperature_c":       func(g GPUInfo) float64 { return float64(g.TemperatureC) },
+	"fan_speed_pct":       func(g GPUInfo) float64 { return float64(g.FanSpeedPct) },
+	"power_draw_w":        func(g GPUInfo) float64 { return g.PowerDrawW },
+	"memory_used_mib":     func(g GPUInfo) float64 { return float64(g.MemoryUsedMiB) },
+	"memory_free_mib":     func(g GPUInfo) float64 { return float64(g.MemoryFreeMiB) },
+	"gpu_utilization_pct": func(g GPUInfo) float64 { return float64(g.GPUUtilizationPct) },
+	"mem_utilization_pct": func(g GPUInfo) float64 { return float64(g.MemUtilizationPct) },
+	"util_per_watt":       func(g GPUInfo) float64 { return g.UtilPerWatt },
+}
+
+type grafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	MaxDataPoints int `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is one timeseries; datapoints are [value, unix ms] pairs.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaTargets lists the queryable targets: every field, then every
+// field per GPU in metrics.
+func grafanaTargets(metrics *GPUMetrics) []string {
+	fields := make([]string, 0, len(grafanaFields))
+	for name := range grafanaFields {
+		fields = append(fields, name)
+	}
+	slices.Sort(fields)
+	targets := slices.Clone(fields)
+	if metrics != nil {
+		for _, g := range metrics.GPUs {
+			for _, f := range fields {
+				targets = append(targets, fmt.Sprintf("gpu%d.%s", g.Index, f))
+			}
+		}
+	}
+	return targets
+}
+
+// grafanaQuery returns the series for one target from samples, thinned to
+// at most maxPoints points each (0 for no limit).
+func grafanaQuery(samples []historySample, target string, maxPoints int) ([]grafanaSeries, error) {
+	gpu, field := -1, target
+	if prefix, name, ok := strings.Cut(target, "."); ok {
+		n, err := strconv.Atoi(strings.TrimPrefix(prefix, "gpu"))
+		if err != nil || !strings.HasPrefix(prefix, "gpu") {
+			return nil, fmt.Errorf("invalid target %q: want <field> or gpu<index>.<field>", target)
+		}
+		gpu, field = n, name
+	}
+	value, ok := grafanaFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q in target %q", field, target)
+	}
+
+	step := 1
+	if maxPoints > 0 && len(samples) > maxPoints {
+		step = (len(samples) + maxPoints - 1) / maxPoints
+	}
+	var series []grafanaSeries
+	byIndex := make(map[int]int) // GPU index to position in series
+	for i := 0; i < len(samples); i += step {
+		s := samples[i]
+		ms := float64(s.Time.UnixMilli())
+		for _, g := range s.Metrics.GPUs {
+			if gpu >= 0 && g.Index != gpu {
+				continue
+			}
+			pos, ok := byIndex[g.Index]
+			if !ok {
+				pos = len(series)
+				byIndex[g.Index] = pos
+				series = append(series, grafanaSeries{Target: fmt.Sprintf("gpu%d.%s", g.Index, field), Datapoints: [][2]float64{}})
+			}
+			series[pos].Datapoints = append(series[pos].Datapoints, [2]float64{value(g), ms})
+		}
+	}
+	slices.SortFunc(series, func(a, b grafanaSeries) int { return strings.Compare(a.Target, b.Target) })
+	return series, nil
+}
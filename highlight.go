@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"path"
+	"path/filepath"
+)
+
+// otherProcessName is the name of the entry non-highlighted processes are
+// collapsed into.
+const otherProcessName = "other"
+
+// processHighlighter marks the GPU processes named in HIGHLIGHT_PROCESSES
+// and, with COLLAPSE_OTHER_PROCESSES=true, merges the rest of each GPU's
+// processes into a single "other" entry.
+type processHighlighter struct {
+	patterns []string // shell patterns matched against the executable name
+	collapse bool
+}
+
+// newProcessHighlighter returns nil unless HIGHLIGHT_PROCESSES is set.
+func newProcessHighlighter() *processHighlighter {
+	patterns := envList("HIGHLIGHT_PROCESSES")
+	if len(patterns) == 0 {
+		return nil
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			log.Printf("HIGHLIGHT_PROCESSES: invalid pattern %q: %v", p, err)
+		}
+	}
+	return &processHighlighter{patterns: patterns, collapse: envBool("COLLAPSE_OTHER_PROCESSES")}
+}
+
+// matches reports whether the process's executable name, without its
+// directory, matches one of the patterns.
+func (h *processHighlighter) matches(p GPUProcess) bool {
+	name := filepath.Base(p.ProcessName)
+	for _, pattern := range h.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *processHighlighter) apply(metrics *GPUMetrics) {
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		var kept []GPUProcess
+		other := GPUProcess{ProcessName: otherProcessName}
+		for _, p := range g.Processes {
+			p.Highlighted = h.matches(p)
+			if p.Highlighted || !h.collapse {
+				kept = append(kept, p)
+				continue
+			}
+			other.MergedCount++
+			other.UsedMemoryMiB += p.UsedMemoryMiB
+			other.SMUtilPct += p.SMUtilPct
+			other.MemUtilPct += p.MemUtilPct
+		}
+		if other.MergedCount > 0 {
+			kept = append(kept, other)
+		}
+		if kept == nil {
+			kept = []GPUProcess{}
+		}
+		g.Processes = kept
+	}
+}
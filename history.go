@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// historySample is one GPU snapshot and when it was taken. Snapshot
+// timestamps only have second resolution, so the sample keeps its own.
+type historySample struct {
+	Time    time.Time   `json:"time"`
+	Metrics *GPUMetrics `json:"metrics"`
+}
+
+// gpuHistory is a fixed-size ring buffer of recent GPU snapshots. The
+// snapshots are shared with Latest() and must not be modified.
+type gpuHistory struct {
+	mu      sync.RWMutex
+	samples []historySample
+	next    int
+	full    bool
+}
+
+func newGPUHistory(size int) *gpuHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &gpuHistory{samples: make([]historySample, size)}
+}
+
+func (h *gpuHistory) add(t time.Time, metrics *GPUMetrics) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = historySample{Time: t, Metrics: metrics}
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// since returns the samples taken at or after t, oldest first.
+func (h *gpuHistory) since(t time.Time) []historySample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var out []historySample
+	appendFrom := func(samples []historySample) {
+		for _, s := range samples {
+			if s.Metrics != nil && !s.Time.Before(t) {
+				out = append(out, s)
+			}
+		}
+	}
+	if h.full {
+		appendFrom(h.samples[h.next:])
+	}
+	appendFrom(h.samples[:h.next])
+	return out
+}
+
+// History returns the snapshots taken at or after since, oldest first.
+func (m *GPUMonitor) History(since time.Time) []historySample {
+	return m.history.since(since)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime/debug"
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision"`
+	Time      string `json:"time"`
+	Modified  bool   `json:"modified"`
+}
+
+type ServerInfo struct {
+	Hostname      string    `json:"hostname"`
+	DriverVersion string    `json:"driver_version"`
+	CUDAVersion   string    `json:"cuda_version"`
+	OllamaVersion string    `json:"ollama_version"`
+	Build         BuildInfo `json:"build"`
+	SchemaVersion int       `json:"schema_version"` // see api.SchemaVersion
+	// Advisories are operational hints about the host's GPUs, currently
+	// the per-GPU persistence_advisory.
+	Advisories []string `json:"advisories"`
+}
+
+func collectServerInfo(gpuMon *GPUMonitor, ollamaMon *OllamaMonitor) ServerInfo {
+	info := ServerInfo{Build: buildInfo(), SchemaVersion: schemaVersion}
+	info.Hostname, _ = os.Hostname()
+	info.DriverVersion, info.CUDAVersion = gpuMon.Versions()
+	if stats := ollamaMon.Latest(); stats != nil {
+		info.OllamaVersion = stats.Version
+	}
+	info.Advisories = []string{}
+	if metrics := gpuMon.Latest(); metrics != nil {
+		for _, g := range metrics.GPUs {
+			if g.PersistenceAdvisory != "" {
+				info.Advisories = append(info.Advisories, fmt.Sprintf("GPU %d: %s", g.Index, g.PersistenceAdvisory))
+			}
+		}
+	}
+	return info
+}
+
+func buildInfo() BuildInfo {
+	var b BuildInfo
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Version = bi.Main.Version
+	b.GoVersion = bi.GoVersion
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+var (
+	driverVersionRe = regexp.MustCompile(`Driver Version:\s*([0-9.]+)`)
+	cudaVersionRe   = regexp.MustCompile(`CUDA Version:\s*([0-9.]+)`)
+)
+
+// parseSMIHeader extracts the driver and CUDA versions from the banner
+// printed by a bare `nvidia-smi` invocation.
+func parseSMIHeader(out []byte) (driver, cuda string) {
+	if m := driverVersionRe.FindSubmatch(out); m != nil {
+		driver = string(m[1])
+	}
+	if m := cudaVersionRe.FindSubmatch(out); m != nil {
+		cuda = string(m[1])
+	}
+	return driver, cuda
+}
@@ -0,0 +1,138 @@
+package main
+
+import "strings"
+
+// Plausibility bounds for the GGUF metadata used by the KV cache estimate.
+// Values outside them mean corrupt or unexpected metadata, and produce an
+// absurd estimate rather than a slightly wrong one.
+const (
+	maxLayers        = 1024
+	maxHeads         = 1024
+	maxEmbeddingLen  = 1 << 17
+	maxHeadDim       = 4096
+	maxContextLength = 1 << 24
+)
+
+// kvDtypeBytes is the storage cost per cached element for each
+// OLLAMA_KV_CACHE_TYPE. Unknown types are estimated as f16.
+var kvDtypeBytes = map[string]float64{
+	"f16":  2.0,
+	"bf16": 2.0,
+	"q8_0": 1.0625, // 34 bytes per block of 32
+	"fp8":  1.0,
+	"q4_0": 0.5625, // 18 bytes per block of 32
+}
+
+// activationBatch is the micro-batch size llama.cpp computes attention
+// over, and so the batch dimension of the attention score buffer.
+const activationBatch = 512
+
+func kvDtypeBytesPerElement(dtype string) float64 {
+	if b, ok := kvDtypeBytes[dtype]; ok {
+		return b
+	}
+	return kvDtypeBytes["f16"]
+}
+
+// detectKVCacheType returns the KV cache type a local Ollama server uses,
+// given its environment, or "" if unknown. Ollama only quantizes the cache
+// with flash attention enabled and otherwise falls back to f16.
+func detectKVCacheType(serverEnv map[string]string) string {
+	if serverEnv == nil {
+		return ""
+	}
+	dtype := strings.ToLower(serverEnv["OLLAMA_KV_CACHE_TYPE"])
+	if dtype == "" {
+		return "f16"
+	}
+	if isTruthy(serverEnv["OLLAMA_FLASH_ATTENTION"]) {
+		return dtype
+	}
+	return "f16"
+}
+
+// detectFlashAttention reports whether a local Ollama server has
+// FlashAttention enabled, given its environment; known is false if the
+// environment isn't readable.
+func detectFlashAttention(serverEnv map[string]string) (enabled, known bool) {
+	if serverEnv == nil {
+		return false, false
+	}
+	return isTruthy(serverEnv["OLLAMA_FLASH_ATTENTION"]), true
+}
+
+func isTruthy(v string) bool {
+	switch strings.ToLower(v) {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+func inRange(v, max int) bool {
+	return v > 0 && v <= max
+}
+
+// estimateKVCache estimates the KV cache needed to hold kvTokens tokens,
+// and the attention score buffer, which only exists without
+// FlashAttention. Both live in the model's VRAM allocation, so when
+// sizeVRAM is known (> 0) they are capped to it. ok is false when the
+// model metadata is missing or implausible.
+func estimateKVCache(info map[string]interface{}, arch string, kvTokens int, dtype string, flashAttn bool, sizeVRAM int64) (kv KVCacheInfo, activation int64, ok bool) {
+	nLayers := modelInfoInt(info, arch+".block_count")
+	nHeads := modelInfoInt(info, arch+".attention.head_count")
+	nKVHeads := modelInfoInt(info, arch+".attention.head_count_kv")
+	embLen := modelInfoInt(info, arch+".embedding_length")
+	if !inRange(nLayers, maxLayers) || !inRange(nHeads, maxHeads) ||
+		!inRange(nKVHeads, nHeads) || !inRange(embLen, maxEmbeddingLen) ||
+		!inRange(kvTokens, maxContextLength) {
+		return KVCacheInfo{}, 0, false
+	}
+
+	// Models may declare per-head key/value sizes that differ from
+	// embLen/nHeads (Gemma, for one). Without them llama.cpp uses the
+	// truncated quotient, so the estimate does the same.
+	keyLen := modelInfoInt(info, arch+".attention.key_length")
+	if !inRange(keyLen, maxHeadDim) {
+		keyLen = embLen / nHeads
+	}
+	valueLen := modelInfoInt(info, arch+".attention.value_length")
+	if !inRange(valueLen, maxHeadDim) {
+		valueLen = embLen / nHeads
+	}
+	if keyLen == 0 || valueLen == 0 {
+		return KVCacheInfo{}, 0, false
+	}
+
+	if _, known := kvDtypeBytes[dtype]; !known {
+		dtype = "f16"
+	}
+	perElement := kvDtypeBytesPerElement(dtype)
+	bytesPerToken := int(float64(nLayers*nKVHeads*(keyLen+valueLen)) * perElement)
+	maxBytes := int64(bytesPerToken) * int64(kvTokens)
+	if !flashAttn {
+		activation = int64(nHeads) * int64(kvTokens) * activationBatch * 4
+	}
+	// An estimate larger than the whole allocation is certainly wrong.
+	clamped := false
+	if sizeVRAM > 0 && maxBytes > sizeVRAM {
+		maxBytes, clamped = sizeVRAM, true
+	}
+	if sizeVRAM > 0 {
+		activation = min(activation, sizeVRAM-maxBytes)
+	}
+	return KVCacheInfo{
+		DType:           dtype,
+		BytesPerToken:   bytesPerToken,
+		MaxSizeBytes:    maxBytes,
+		MaxSizeMiB:      float64(maxBytes) / (1024 * 1024),
+		Layers:          nLayers,
+		KVHeads:         nKVHeads,
+		KeyLength:       keyLen,
+		ValueLength:     valueLen,
+		BytesPerElement: perElement,
+		Tokens:          kvTokens,
+		FlashAttention:  flashAttn,
+		Clamped:         clamped,
+	}, activation, true
+}
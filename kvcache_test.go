@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestEstimateKVCache(t *testing.T) {
+	llama := func(layers, heads, kvHeads, embLen float64) map[string]interface{} {
+		return map[string]interface{}{
+			"llama.block_count":             layers,
+			"llama.attention.head_count":    heads,
+			"llama.attention.head_count_kv": kvHeads,
+			"llama.embedding_length":        embLen,
+		}
+	}
+	gemma := llama(26, 8, 4, 2304)
+	gemma["llama.attention.key_length"] = float64(256)
+	gemma["llama.attention.value_length"] = float64(256)
+
+	for _, tc := range []struct {
+		name       string
+		info       map[string]interface{}
+		tokens     int
+		dtype      string
+		flashAttn  bool
+		ok         bool
+		perToken   int
+		dtypeUsed  string
+		activation int64
+		sizeVRAM   int64
+	}{
+		{"llama 8B", llama(32, 32, 8, 4096), 2048, "f16", true, true, 32 * 8 * 256 * 2, "f16", 0, 0},
+		{"q8_0", llama(32, 32, 8, 4096), 2048, "q8_0", true, true, 32 * 8 * 256 * 17 / 16, "q8_0", 0, 0},
+		{"unknown dtype as f16", llama(32, 32, 8, 4096), 2048, "q2_k", true, true, 32 * 8 * 256 * 2, "f16", 0, 0},
+		{"without flash attention", llama(32, 32, 8, 4096), 2048, "f16", false, true, 32 * 8 * 256 * 2, "f16", 32 * 2048 * activationBatch * 4, 0},
+		// 4000/48 truncates to 83, as llama.cpp does.
+		{"non-divisible embedding", llama(2, 48, 8, 4000), 1024, "f16", true, true, 2 * 8 * (83 + 83) * 2, "f16", 0, 0},
+		{"declared head size", gemma, 1024, "f16", true, true, 26 * 4 * 512 * 2, "f16", 0, 0},
+		// At 128k tokens the unbounded buffer (8 GiB) would overflow the
+		// 20 GiB allocation with the 16 GiB KV cache.
+		{"activation capped to allocation", llama(32, 32, 8, 4096), 131072, "f16", false, true, 32 * 8 * 256 * 2, "f16", 4 << 30, 20 << 30},
+		{"embedding shorter than heads", llama(32, 32, 8, 16), 2048, "f16", true, false, 0, "", 0, 0},
+		{"zero heads", llama(32, 0, 8, 4096), 2048, "f16", true, false, 0, "", 0, 0},
+		{"zero KV heads", llama(32, 32, 0, 4096), 2048, "f16", true, false, 0, "", 0, 0},
+		{"more KV heads than heads", llama(32, 8, 32, 4096), 2048, "f16", true, false, 0, "", 0, 0},
+		{"zero layers", llama(0, 32, 8, 4096), 2048, "f16", true, false, 0, "", 0, 0},
+		{"zero tokens", llama(32, 32, 8, 4096), 0, "f16", true, false, 0, "", 0, 0},
+		{"implausible layers", llama(maxLayers+1, 32, 8, 4096), 2048, "f16", true, false, 0, "", 0, 0},
+		{"no metadata", map[string]interface{}{}, 2048, "f16", true, false, 0, "", 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kv, activation, ok := estimateKVCache(tc.info, "llama", tc.tokens, tc.dtype, tc.flashAttn, tc.sizeVRAM)
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			if !ok {
+				return
+			}
+			if kv.BytesPerToken != tc.perToken || kv.DType != tc.dtypeUsed {
+				t.Errorf("got %d bytes per token as %s, want %d as %s", kv.BytesPerToken, kv.DType, tc.perToken, tc.dtypeUsed)
+			}
+			if want := int64(tc.perToken) * int64(tc.tokens); kv.MaxSizeBytes != want {
+				t.Errorf("MaxSizeBytes = %d, want %d", kv.MaxSizeBytes, want)
+			}
+			if activation != tc.activation {
+				t.Errorf("activation = %d, want %d", activation, tc.activation)
+			}
+		})
+	}
+}
@@ -1,73 +1,523 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"slices"
+	"strings"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 func main() {
-	gpuMon := NewGPUMonitor()
+	diagnose := flag.Bool("diagnose", false, "check nvidia-smi, the driver, Ollama and the configuration, print a report and exit")
+	configPath := flag.String("config", "", "JSON `file` of settings keyed by environment variable name; set variables take precedence")
+	flag.Parse()
+	cfg, err := loadConfig(*configPath)
+	if *diagnose {
+		os.Exit(runDiagnostics(os.Stdout, cfg, err))
+	}
+	if err != nil {
+		log.Fatal("invalid configuration: ", err)
+	}
+	fmt.Println("configuration:")
+	cfg.print(os.Stdout)
+
+	gpuMon := NewGPUMonitor(cfg)
 	gpuMon.Start()
 	defer gpuMon.Stop()
 
-	ollamaMon := NewOllamaMonitor()
+	ollamaMon := NewOllamaMonitor(cfg)
+	ollamaMon.SetGPUSource(gpuMon.Latest)
 	ollamaMon.Start()
 	defer ollamaMon.Stop()
 
-	http.HandleFunc("/api/gpus", func(w http.ResponseWriter, r *http.Request) {
-		metrics := gpuMon.Latest()
+	go watchFDs(30 * time.Second)
+
+	shutdownOTLP, err := startOTLP(gpuMon, ollamaMon)
+	if err != nil {
+		log.Printf("otlp export disabled: %v", err)
+	} else if shutdownOTLP != nil {
+		defer shutdownOTLP(context.Background())
+		fmt.Println("exporting metrics over OTLP")
+	}
+
+	floatPrecision = cfg.FloatPrecision
+
+	mux := http.NewServeMux()
+
+	// With ADMIN_ADDR set, metrics, refresh, control, debug and pprof
+	// routes move to a second listener so the main port only serves the
+	// read-only API, including /ws.
+	adminAddr := cfg.AdminAddr
+	admin := mux
+	if adminAddr != "" {
+		admin = http.NewServeMux()
+	}
+
+	// Data handlers get a deadline so a hung nvidia-smi or Ollama call
+	// turns into a 504 instead of a stuck connection.
+	handlerTimeout := cfg.HandlerTimeout
+	data := func(h http.HandlerFunc) http.Handler {
+		return withTimeout(h, handlerTimeout)
+	}
+
+	// Payload sizes of the main data endpoints, for capacity planning of
+	// the service itself.
+	sizes := newResponseSizes()
+
+	mux.Handle("GET /api/gpus", sizes.track("/api/gpus", data(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := gpuMon.Current()
+		if metrics == nil {
+			var smiErr *SMIError
+			switch {
+			case errors.As(err, &smiErr):
+				writeJSONError(w, http.StatusServiceUnavailable, smiErr.Reason, smiErr.Error())
+			case err != nil:
+				writeJSONError(w, http.StatusServiceUnavailable, reasonUnknown, err.Error())
+			default:
+				writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			}
+			return
+		}
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeGPUText(w, metrics)
+			return
+		}
+		if wantsPrometheus(r.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", prometheusContentType)
+			writePrometheus(w, collectGPUMetrics(metrics))
+			return
+		}
+		writeData(w, r, metrics)
+	})))
+
+	// Long-poll for clients that can't use the WebSocket. It waits longer
+	// than HANDLER_TIMEOUT by design, so it gets its own deadline.
+	longPollWait := cfg.LongPollMaxWait
+	mux.HandleFunc("GET /api/gpus/poll", func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_parameter", "since must be an RFC 3339 timestamp")
+				return
+			}
+			since = t
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), longPollWait)
+		defer cancel()
+		metrics := gpuMon.WaitNewer(ctx, since)
 		if metrics == nil {
-			http.Error(w, "no data yet", http.StatusServiceUnavailable)
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(metrics)
+		writeData(w, r, metrics)
 	})
 
-	http.HandleFunc("/api/ollama/stats", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("GET /api/gpus/by-uuid/{uuid}", data(func(w http.ResponseWriter, r *http.Request) {
+		metrics := gpuMon.Latest()
+		if metrics == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			return
+		}
+		uuid := r.PathValue("uuid")
+		i := slices.IndexFunc(metrics.GPUs, func(g GPUInfo) bool { return strings.EqualFold(g.UUID, uuid) })
+		if i < 0 {
+			writeJSONError(w, http.StatusNotFound, "gpu_not_found", "no GPU with UUID "+uuid)
+			return
+		}
+		writeData(w, r, metrics.GPUs[i])
+	}))
+
+	mux.Handle("GET /api/gpus/top", data(func(w http.ResponseWriter, r *http.Request) {
+		metrics := gpuMon.Latest()
+		if metrics == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			return
+		}
+		top, err := topGPUs(metrics, r.URL.Query().Get("by"), r.URL.Query().Get("limit"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+		writeData(w, r, top)
+	}))
+
+	mux.Handle("GET /api/gpus/models", data(func(w http.ResponseWriter, r *http.Request) {
+		metrics := gpuMon.Latest()
+		if metrics == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			return
+		}
+		writeData(w, r, gpuModels(metrics))
+	}))
+
+	mux.Handle("GET /api/gpus/rollup", data(func(w http.ResponseWriter, r *http.Request) {
+		rollup, err := rollupGPUs(gpuMon.History, r.URL.Query().Get("seconds"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+		writeData(w, r, rollup)
+	}))
+
+	mux.Handle("GET /api/gpus/history", data(func(w http.ResponseWriter, r *http.Request) {
+		q, now := r.URL.Query(), time.Now()
+		since, until, step, err := historyRange(q.Get("since"), q.Get("until"), q.Get("step"), now, now.Add(-cfg.HistoryRetention))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+		samples := gpuMon.History(since)
+		for len(samples) > 0 && samples[len(samples)-1].Time.After(until) {
+			samples = samples[:len(samples)-1]
+		}
+		writeData(w, r, GPUHistory{
+			Timestamp:   now.UTC().Format(time.RFC3339),
+			Since:       since.UTC(),
+			Until:       until.UTC(),
+			StepSeconds: step.Seconds(),
+			GPUs:        historySeries(samples, step),
+		})
+	}))
+
+	// Grafana SimpleJSON datasource; see grafana.go.
+	mux.Handle("GET /grafana/{$}", data(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"status": "ok"})
+	}))
+	mux.Handle("POST /grafana/search", data(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Target string `json:"target"`
+		}
+		// The body is optional; older Grafana versions send none.
+		json.NewDecoder(r.Body).Decode(&req)
+		names := []string{}
+		for _, name := range grafanaTargets(gpuMon.Latest()) {
+			if strings.Contains(name, req.Target) {
+				names = append(names, name)
+			}
+		}
+		writeJSON(w, names)
+	}))
+	mux.Handle("POST /grafana/query", data(func(w http.ResponseWriter, r *http.Request) {
+		var req grafanaQueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+		samples := gpuMon.History(req.Range.From)
+		for len(samples) > 0 && !req.Range.To.IsZero() && samples[len(samples)-1].Time.After(req.Range.To) {
+			samples = samples[:len(samples)-1]
+		}
+		series := []grafanaSeries{}
+		for _, t := range req.Targets {
+			s, err := grafanaQuery(samples, t.Target, req.MaxDataPoints)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_target", err.Error())
+				return
+			}
+			series = append(series, s...)
+		}
+		writeJSON(w, series)
+	}))
+
+	mux.Handle("GET /api/gpus/mapping", data(func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, r, gpuMon.Mapping())
+	}))
+
+	mux.Handle("GET /api/counters", data(func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, r, gpuMon.Counters())
+	}))
+
+	mux.Handle("GET /api/gpus/accounting", data(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := gpuMon.Accounting()
+		if errors.Is(err, errAccountingDisabled) {
+			writeJSONError(w, http.StatusConflict, "accounting_disabled", err.Error())
+			return
+		}
+		if err != nil {
+			reason := reasonUnknown
+			var smiErr *SMIError
+			if errors.As(err, &smiErr) {
+				reason = smiErr.Reason
+			}
+			writeJSONError(w, http.StatusServiceUnavailable, reason, err.Error())
+			return
+		}
+		writeData(w, r, stats)
+	}))
+
+	mux.Handle("GET /api/ollama/stats", sizes.track("/api/ollama/stats", data(func(w http.ResponseWriter, r *http.Request) {
 		stats := ollamaMon.Latest()
 		if stats == nil {
-			http.Error(w, "no data yet", http.StatusServiceUnavailable)
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(stats)
-	})
+		writeData(w, r, stats)
+	})))
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+	catalogMaxAge := cfg.CatalogMaxAge
+	mux.Handle("GET /api/ollama/models", data(func(w http.ResponseWriter, r *http.Request) {
+		catalog := ollamaMon.Catalog()
+		if catalog == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			return
+		}
+		if catalogMaxAge > 0 {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(catalogMaxAge.Seconds())))
+		}
+		writeData(w, r, catalog)
+	}))
+
+	mux.Handle("GET /api/ollama/model-stats", data(func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, r, ollamaMon.ModelUsage())
+	}))
+
+	mux.Handle("GET /api/ollama/capacity", data(func(w http.ResponseWriter, r *http.Request) {
+		model := r.URL.Query().Get("model")
+		if model == "" {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameter", "model is required")
+			return
+		}
+		metrics := gpuMon.Latest()
+		if metrics == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "no_data", "no data yet")
+			return
+		}
+		footprint, err := ollamaMon.Footprint(model)
+		switch {
+		case errors.Is(err, errModelNotFound):
+			writeJSONError(w, http.StatusNotFound, "model_not_found", model+" is not pulled")
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusBadGateway, "ollama_error", err.Error())
+			return
+		}
+		capacity, err := modelCapacity(model, footprint, metrics)
 		if err != nil {
-			log.Println("ws upgrade:", err)
+			writeJSONError(w, http.StatusUnprocessableEntity, "unknown_size", err.Error())
+			return
+		}
+		writeData(w, r, capacity)
+	}))
+
+	mux.Handle("GET /api/info", data(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, collectServerInfo(gpuMon, ollamaMon))
+	}))
+
+	admin.Handle("GET /api/self", data(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, SelfStats{Responses: sizes.snapshot(), Resources: resourceUsage()})
+	}))
+
+	// The passthrough streams, so it isn't wrapped by data's timeout.
+	if cfg.EnableOllamaProxy {
+		proxy, err := newOllamaProxy(ollamaMon.Host(), ollamaMon.Transport())
+		if err != nil {
+			log.Fatalf("ollama proxy: %v", err)
+		}
+		var h http.Handler = proxy
+		if cfg.ProxyMaxBodyBytes > 0 {
+			h = limitBody(h, int64(cfg.ProxyMaxBodyBytes))
+		}
+		mux.Handle("/ollama/", h)
+		mux.Handle("GET /api/ollama/proxy", data(func(w http.ResponseWriter, r *http.Request) {
+			writeData(w, r, proxy.Stats())
+		}))
+		fmt.Println("proxying /ollama/ to", ollamaMon.Host())
+	}
+
+	if cluster := NewCluster(); cluster.Enabled() {
+		mux.Handle("GET /api/cluster/gpus", data(func(w http.ResponseWriter, r *http.Request) {
+			writeData(w, r, cluster.GPUs(r.Context()))
+		}))
+	}
+
+	// Refreshes closer together than this return the last snapshot, so
+	// the endpoint can't be used to hammer nvidia-smi. It triggers polls,
+	// so it isn't part of the read-only API.
+	refreshMinInterval := cfg.RefreshMinInterval
+	admin.Handle("POST /api/refresh", data(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			target = "all"
+		}
+		if target != "all" && target != "gpu" && target != "ollama" {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameter", "target must be gpu, ollama or all")
 			return
 		}
-		defer conn.Close()
 
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
+		var result RefreshResult
+		if target != "ollama" {
+			metrics, err := gpuMon.Refresh(refreshMinInterval)
+			if err != nil {
+				reason := reasonUnknown
+				var smiErr *SMIError
+				if errors.As(err, &smiErr) {
+					reason = smiErr.Reason
+				}
+				writeJSONError(w, http.StatusServiceUnavailable, reason, err.Error())
+				return
+			}
+			result.GPU = metrics
+		}
+		if target != "gpu" {
+			result.Ollama = ollamaMon.Refresh(refreshMinInterval)
+		}
+		writeData(w, r, result)
+	}))
+
+	admin.Handle("GET /metrics", data(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		writePrometheus(w, collectGPUMetrics(gpuMon.Latest()))
+		writePrometheus(w, collectOllamaMetrics(ollamaMon.Latest()))
+		writePrometheus(w, collectSelfMetrics(sizes))
+	}))
+
+	// /ws only streams the snapshots the pollers take anyway, so it stays
+	// on the main port.
+	mux.HandleFunc("GET /ws", serveWS(gpuMon, ollamaMon, cfg))
+
+	// Control endpoints change state, so they need ENABLE_CONTROL and a
+	// bearer token.
+	if cfg.EnableControl {
+		token := cfg.ControlToken
+		control := func(h http.HandlerFunc) http.Handler {
+			return requireToken(data(h), token)
+		}
+
+		admin.Handle("POST /api/ollama/unload", control(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Model string `json:"model"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+				writeJSONError(w, http.StatusBadRequest, "invalid_body", `body must be {"model": "<name>"}`)
+				return
+			}
+			stats := ollamaMon.Refresh(0)
+			if !slices.ContainsFunc(stats.RunningModels, func(m RunningModel) bool { return m.Name == req.Model }) {
+				writeJSONError(w, http.StatusNotFound, "model_not_running", req.Model+" is not loaded")
+				return
+			}
+			if err := ollamaMon.Unload(r.Context(), req.Model); err != nil {
+				writeJSONError(w, http.StatusBadGateway, "ollama_error", err.Error())
+				return
+			}
+			log.Printf("control: unloaded %s (from %s)", req.Model, r.RemoteAddr)
+			// Ollama can still list the model in /api/ps for a moment
+			// while it's being unloaded, so leave it out here. The
+			// snapshot is shared, so filter into a new slice.
+			remaining := []RunningModel{}
+			for _, m := range ollamaMon.Refresh(0).RunningModels {
+				if m.Name != req.Model {
+					remaining = append(remaining, m)
+				}
+			}
+			writeData(w, r, remaining)
+		}))
 
-		for range ticker.C {
-			payload := struct {
-				GPU    *GPUMetrics  `json:"gpu"`
-				Ollama *OllamaStats `json:"ollama"`
-			}{
-				GPU:    gpuMon.Latest(),
-				Ollama: ollamaMon.Latest(),
+		admin.Handle("POST /api/counters/reset", control(func(w http.ResponseWriter, r *http.Request) {
+			kind := r.URL.Query().Get("counter")
+			if kind == "" {
+				kind = "all"
 			}
-			if err := conn.WriteJSON(payload); err != nil {
-				break
+			before, err := gpuMon.ResetCounters(kind)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+				return
 			}
+			log.Printf("control: reset %s counters (from %s)", kind, r.RemoteAddr)
+			writeData(w, r, before)
+		}))
+
+		fmt.Println("control endpoints enabled")
+	}
+
+	// Raw nvidia-smi output is opt-in: it's only useful for debugging
+	// parse problems and shows process names and paths.
+	if cfg.EnableDebug {
+		admin.HandleFunc("GET /api/debug/nvidia-smi", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if err := gpuMon.WriteRawSMI(w); err != nil {
+				writeJSONError(w, http.StatusConflict, "not_nvidia_smi", err.Error())
+			}
+		})
+		fmt.Println("debug enabled at /api/debug/nvidia-smi")
+	}
+
+	// pprof is opt-in: it exposes internals and can be used to burn CPU.
+	if cfg.EnablePprof {
+		admin.HandleFunc("/debug/pprof/", pprof.Index)
+		admin.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		admin.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		admin.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		admin.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		fmt.Println("pprof enabled at /debug/pprof/")
+	}
+
+	if cfg.Mock {
+		fmt.Println("mock mode: serving synthetic GPU and Ollama data")
+	}
+
+	maxBody := int64(cfg.MaxBodyBytes)
+	logRequests := cfg.AccessLog
+	wrap := func(h http.Handler) http.Handler {
+		// The passthrough has its own limit: prompts and base64 images
+		// sent to Ollama are far larger than anything our API takes.
+		h = limitBodyExcept(h, maxBody, "/ollama/")
+		if logRequests {
+			h = accessLog(h)
 		}
-	})
+		return h
+	}
+
+	if adminAddr != "" {
+		go func() {
+			fmt.Println("admin listening on", adminAddr)
+			log.Fatal(http.ListenAndServe(adminAddr, wrap(admin)))
+		}()
+	}
 
 	fmt.Println("listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", wrap(mux)))
+}
+
+// writeJSON encodes v as the response body. Responses are marked
+// no-store unless the handler already chose a caching policy, so proxies
+// never serve stale live data.
+func writeJSON(w http.ResponseWriter, v any) {
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// RefreshResult is the response of POST /api/refresh; only the targets
+// that were refreshed are set.
+type RefreshResult struct {
+	GPU    *GPUMetrics  `json:"gpu,omitempty"`
+	Ollama *OllamaStats `json:"ollama,omitempty"`
+}
+
+type apiError struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func writeJSONError(w http.ResponseWriter, status int, reason, msg string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: msg, Reason: reason})
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// GPUMapping is the response of /api/gpus/mapping: the current UUID to
+// index assignment, and with persistence enabled, any GPU whose index
+// differs from the previous run.
+type GPUMapping struct {
+	Mapping map[string]int `json:"mapping"`
+	// Persisted is set when the mapping is saved under DATA_DIR, which is
+	// what makes IndexChanges meaningful.
+	Persisted     bool          `json:"persisted"`
+	PreviousRunAt string        `json:"previous_run_at,omitempty"`
+	IndexChanges  []IndexChange `json:"index_changes"`
+}
+
+type IndexChange struct {
+	UUID          string `json:"uuid"`
+	Index         int    `json:"index"`
+	PreviousIndex int    `json:"previous_index"`
+}
+
+// savedMapping is the on-disk form, DATA_DIR/gpu-mapping.json.
+type savedMapping struct {
+	SavedAt time.Time      `json:"saved_at"`
+	GPUs    map[string]int `json:"gpus"`
+}
+
+// gpuMapping tracks the UUID to index assignment. The previous run's
+// mapping is loaded once at startup and compared against every poll; the
+// file is rewritten only when the current mapping changes.
+type gpuMapping struct {
+	path string // empty when not persisted
+
+	mu       sync.Mutex
+	previous *savedMapping
+	current  map[string]int
+}
+
+func newGPUMapping(dir string) *gpuMapping {
+	g := &gpuMapping{current: make(map[string]int)}
+	if dir == "" {
+		return g
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Println("gpu mapping not persisted:", err)
+		return g
+	}
+	g.path = filepath.Join(dir, "gpu-mapping.json")
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("gpu mapping:", err)
+		}
+		return g
+	}
+	var saved savedMapping
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("gpu mapping: ignoring %s: %v", g.path, err)
+		return g
+	}
+	g.previous = &saved
+	return g
+}
+
+// observe records the mapping from a poll and saves it if it changed.
+// GPUs that vanish keep their last index, so a GPU falling off the bus
+// doesn't erase where it was.
+func (g *gpuMapping) observe(metrics *GPUMetrics) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	changed := false
+	for _, gpu := range metrics.GPUs {
+		if idx, ok := g.current[gpu.UUID]; !ok || idx != gpu.Index {
+			g.current[gpu.UUID] = gpu.Index
+			changed = true
+		}
+	}
+	if !changed || g.path == "" {
+		return
+	}
+	if previous := g.previous; previous != nil {
+		for uuid, idx := range g.current {
+			if old, ok := previous.GPUs[uuid]; ok && old != idx {
+				log.Printf("gpu %s moved from index %d to %d since the previous run", uuid, old, idx)
+			}
+		}
+	}
+	data, err := json.Marshal(savedMapping{SavedAt: time.Now().UTC(), GPUs: g.current})
+	if err != nil {
+		return
+	}
+	// Write and rename so a crash can't leave a truncated file behind.
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Println("gpu mapping:", err)
+		return
+	}
+	if err := os.Rename(tmp, g.path); err != nil {
+		log.Println("gpu mapping:", err)
+	}
+}
+
+func (g *gpuMapping) snapshot() *GPUMapping {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := &GPUMapping{
+		Mapping:      maps.Clone(g.current),
+		Persisted:    g.path != "",
+		IndexChanges: []IndexChange{},
+	}
+	if g.previous == nil {
+		return out
+	}
+	out.PreviousRunAt = g.previous.SavedAt.Format(time.RFC3339)
+	for uuid, idx := range g.current {
+		if old, ok := g.previous.GPUs[uuid]; ok && old != idx {
+			out.IndexChanges = append(out.IndexChanges, IndexChange{UUID: uuid, Index: idx, PreviousIndex: old})
+		}
+	}
+	slices.SortFunc(out.IndexChanges, func(a, b IndexChange) int { return a.Index - b.Index })
+	return out
+}
+
+// Mapping returns the UUID to index mapping and any index changes since
+// the previous run.
+func (m *GPUMonitor) Mapping() *GPUMapping {
+	return m.mapping.snapshot()
+}
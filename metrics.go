@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metrics collected from the monitor snapshots. The same families are
+// exposed as Prometheus text on /metrics and on /api/gpus via content
+// negotiation.
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type label struct {
+	name  string
+	value string
+}
+
+type metricSample struct {
+	labels []label
+	value  float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+func (f *metricFamily) add(value float64, labels ...label) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func collectGPUMetrics(metrics *GPUMetrics) []*metricFamily {
+	temp := &metricFamily{name: "gpu_temperature_celsius", help: "GPU core temperature."}
+	fan := &metricFamily{name: "gpu_fan_speed_percent", help: "Fan speed as a percentage of maximum."}
+	power := &metricFamily{name: "gpu_power_draw_watts", help: "Current power draw."}
+	powerLimit := &metricFamily{name: "gpu_power_limit_watts", help: "Enforced power limit."}
+	memUsed := &metricFamily{name: "gpu_memory_used_bytes", help: "Framebuffer memory in use."}
+	memTotal := &metricFamily{name: "gpu_memory_total_bytes", help: "Total framebuffer memory."}
+	memFree := &metricFamily{name: "gpu_memory_free_bytes", help: "Free framebuffer memory."}
+	util := &metricFamily{name: "gpu_utilization_percent", help: "Percent of time a kernel was running."}
+	memUtil := &metricFamily{name: "gpu_memory_utilization_percent", help: "Percent of time device memory was read or written."}
+	pcieGen := &metricFamily{name: "gpu_pcie_link_gen", help: "Current PCIe link generation."}
+	procMem := &metricFamily{name: "gpu_process_used_memory_bytes", help: "GPU memory used by a process."}
+	memTrend := &metricFamily{name: "gpu_memory_trend_bytes_per_second", help: "Slope of memory use over the trend window."}
+
+	if metrics != nil {
+		for _, g := range metrics.GPUs {
+			l := []label{{"gpu", strconv.Itoa(g.Index)}, {"uuid", g.UUID}, {"name", g.Name}}
+			if g.TemperatureAvailable {
+				temp.add(float64(g.TemperatureC), l...)
+			}
+			if g.HasFan {
+				fan.add(float64(g.FanSpeedPct), l...)
+			}
+			if g.PowerDrawAvailable {
+				power.add(g.PowerDrawW, l...)
+			}
+			if g.PowerLimitAvailable {
+				powerLimit.add(g.PowerLimitW, l...)
+			}
+			memUsed.add(mibToBytes(g.MemoryUsedMiB), l...)
+			memTotal.add(mibToBytes(g.MemoryTotalMiB), l...)
+			memFree.add(mibToBytes(g.MemoryFreeMiB), l...)
+			if g.GPUUtilizationAvailable {
+				util.add(float64(g.GPUUtilizationPct), l...)
+			}
+			if g.MemUtilizationAvailable {
+				memUtil.add(float64(g.MemUtilizationPct), l...)
+			}
+			pcieGen.add(float64(g.PCIEGenCurrent), l...)
+			memTrend.add(g.MemoryTrendMiBPerMin*(1<<20)/60, l...)
+			for _, p := range g.Processes {
+				pl := append(l[:3:3], label{"pid", strconv.Itoa(p.PID)}, label{"process_name", p.ProcessName})
+				procMem.add(mibToBytes(p.UsedMemoryMiB), pl...)
+			}
+		}
+	}
+	return []*metricFamily{temp, fan, power, powerLimit, memUsed, memTotal, memFree, util, memUtil, pcieGen, procMem, memTrend}
+}
+
+func collectOllamaMetrics(stats *OllamaStats) []*metricFamily {
+	up := &metricFamily{name: "ollama_up", help: "Whether the Ollama API is reachable."}
+	available := &metricFamily{name: "ollama_available_models", help: "Number of models pulled on the host."}
+	disk := &metricFamily{name: "ollama_disk_usage_bytes", help: "Total size of pulled models."}
+	running := &metricFamily{name: "ollama_running_models", help: "Number of models loaded in memory."}
+	vram := &metricFamily{name: "ollama_model_vram_bytes", help: "VRAM used by a loaded model."}
+	ctx := &metricFamily{name: "ollama_model_context_window_tokens", help: "Context window of a loaded model."}
+	kv := &metricFamily{name: "ollama_model_kv_cache_max_bytes", help: "Estimated maximum KV cache size of a loaded model."}
+
+	if stats != nil {
+		up.add(boolFloat(stats.Running))
+		available.add(float64(stats.AvailableModelsCount))
+		disk.add(float64(stats.TotalDiskUsageBytes))
+		running.add(float64(len(stats.RunningModels)))
+		for _, m := range stats.RunningModels {
+			l := label{"model", m.Name}
+			vram.add(float64(m.SizeVRAMBytes), l)
+			ctx.add(float64(m.ContextWindow), l)
+			kv.add(float64(m.KVCache.MaxSizeBytes), l)
+		}
+	}
+	return []*metricFamily{up, available, disk, running, vram, ctx, kv}
+}
+
+// writePrometheus writes families in the Prometheus text exposition format.
+func writePrometheus(w io.Writer, families []*metricFamily) {
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name)
+		for _, s := range f.samples {
+			io.WriteString(w, f.name)
+			if len(s.labels) > 0 {
+				io.WriteString(w, "{")
+				for i, l := range s.labels {
+					if i > 0 {
+						io.WriteString(w, ",")
+					}
+					fmt.Fprintf(w, "%s=\"%s\"", l.name, escapeLabelValue(l.value))
+				}
+				io.WriteString(w, "}")
+			}
+			fmt.Fprintf(w, " %s\n", formatMetricValue(s.value))
+		}
+	}
+}
+
+// wantsPrometheus reports whether the Accept header prefers the Prometheus
+// text format over JSON.
+func wantsPrometheus(accept string) bool {
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func mibToBytes(mib int) float64 {
+	return float64(mib) * (1 << 20)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
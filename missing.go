@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// xidCheckInterval is how often dmesg is read for the Xid of missing GPUs
+// that don't have one yet. The first GPU to go missing is checked right
+// away. Xids are matched to GPUs by PCI bus ID, so a GPU without one
+// never gets an Xid.
+const xidCheckInterval = time.Minute
+
+// trackMissing records every GPU in metrics as seen and lists the ones
+// seen before that are now absent in metrics.MissingGPUs.
+func (m *GPUMonitor) trackMissing(now time.Time, metrics *GPUMetrics) {
+	if m.seen == nil {
+		m.seen = make(map[string]*MissingGPU)
+	}
+	present := make(map[string]bool, len(metrics.GPUs))
+	for _, g := range metrics.GPUs {
+		present[g.UUID] = true
+		m.seen[g.UUID] = &MissingGPU{
+			UUID:     g.UUID,
+			Index:    g.Index,
+			Name:     g.Name,
+			PCIBusID: g.PCIBusID,
+			LastSeen: now.UTC().Format(time.RFC3339),
+		}
+	}
+
+	metrics.MissingGPUs = []MissingGPU{}
+	var xids map[string]string
+	checkedXID := false
+	for uuid, g := range m.seen {
+		if present[uuid] {
+			continue
+		}
+		if !m.mock && g.LastXID == "" && g.PCIBusID != "" {
+			if !checkedXID && now.Sub(m.lastXIDCheck) >= xidCheckInterval {
+				xids, checkedXID = lastXIDs(), true
+				m.lastXIDCheck = now
+			}
+			g.LastXID = xids[xidBusKey(g.PCIBusID)]
+		}
+		metrics.MissingGPUs = append(metrics.MissingGPUs, *g)
+	}
+	sort.Slice(metrics.MissingGPUs, func(i, j int) bool {
+		return metrics.MissingGPUs[i].Index < metrics.MissingGPUs[j].Index
+	})
+}
+
+// xidRe matches the PCI address in a kernel Xid line such as
+// "NVRM: Xid (PCI:0000:3b:00): 79, pid=..., GPU has fallen off the bus.".
+var xidRe = regexp.MustCompile(`NVRM: Xid \((?:PCI:)?([0-9a-fA-F]+:[0-9a-fA-F]+:[0-9a-fA-F]+)`)
+
+// lastXIDs returns the most recent "NVRM: Xid" line of each GPU in the
+// kernel ring buffer, keyed by xidBusKey. Reading it usually needs root
+// or CAP_SYSLOG, so failures are silently ignored.
+func lastXIDs() map[string]string {
+	out, err := exec.Command("dmesg").Output()
+	if err != nil {
+		return nil
+	}
+	return parseXIDs(string(out))
+}
+
+func parseXIDs(dmesg string) map[string]string {
+	xids := make(map[string]string)
+	for _, line := range strings.Split(dmesg, "\n") {
+		if m := xidRe.FindStringSubmatch(line); m != nil {
+			xids[xidBusKey(m[1])] = strings.TrimSpace(line)
+		}
+	}
+	return xids
+}
+
+// xidBusKey reduces a PCI bus ID to the domain:bus:device the kernel logs
+// with Xids: nvidia-smi's "00000000:3B:00.0" and the kernel's "0000:3b:00"
+// both become "0000:3b:00".
+func xidBusKey(busID string) string {
+	busID, _, _ = strings.Cut(strings.ToLower(busID), ".")
+	parts := strings.Split(busID, ":")
+	if len(parts) != 3 {
+		return busID
+	}
+	domain := parts[0]
+	if len(domain) > 4 {
+		domain = domain[len(domain)-4:]
+	}
+	return fmt.Sprintf("%04s:%s:%s", domain, parts[1], parts[2])
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestParseXIDs(t *testing.T) {
+	dmesg := `[ 1201.000001] NVRM: Xid (PCI:0000:3b:00): 31, pid=4200, name=ollama, Ch 00000010
+[ 1202.000002] nvidia 0000:3b:00.0: enabling device
+[ 1203.000003] NVRM: Xid (PCI:0000:3b:00): 13, pid=4200, Graphics Exception
+[ 1204.000004] NVRM: Xid (PCI:0000:af:00): 79, pid=1906, GPU has fallen off the bus.
+`
+	xids := parseXIDs(dmesg)
+	for _, tc := range []struct{ busID, want string }{
+		{"00000000:3B:00.0", "[ 1203.000003] NVRM: Xid (PCI:0000:3b:00): 13, pid=4200, Graphics Exception"},
+		{"00000000:AF:00.0", "[ 1204.000004] NVRM: Xid (PCI:0000:af:00): 79, pid=1906, GPU has fallen off the bus."},
+		{"00000000:D8:00.0", ""},
+	} {
+		if got := xids[xidBusKey(tc.busID)]; got != tc.want {
+			t.Errorf("Xid for %s = %q, want %q", tc.busID, got, tc.want)
+		}
+	}
+}
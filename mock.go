@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Synthetic data for MOCK=true, so the API can be developed and tested on
+// machines without an NVIDIA GPU or Ollama. Values oscillate over time so
+// charts have something to draw.
+
+type mockBackend struct{}
+
+func (mockBackend) fetch() (*GPUMetrics, error) {
+	return mockGPUMetrics(time.Now()), nil
+}
+
+func mockGPUMetrics(now time.Time) *GPUMetrics {
+	t := float64(now.UnixMilli()) / 1000
+	metrics := &GPUMetrics{
+		Timestamp: now.UTC().Format(time.RFC3339),
+		GPUs:      []GPUInfo{},
+	}
+	for i, uuid := range []string{
+		"GPU-00000000-0000-4000-8000-000000000000",
+		"GPU-00000000-0000-4000-8000-000000000001",
+	} {
+		util := 50 + 45*math.Sin(t/20+float64(i)*math.Pi/2)
+		usedMiB := 9000 + i*4000
+		procMiB := []int{6346, 810}[i] // the mock Ollama models' size_vram
+		metrics.GPUs = append(metrics.GPUs, GPUInfo{
+			Index:             i,
+			Name:              "NVIDIA GeForce RTX 4090",
+			UUID:              uuid,
+			PCIBusID:          fmt.Sprintf("00000000:%02X:00.0", i+1),
+			DriverVersion:     "550.54.14",
+			PersistenceMode:   "enabled",
+			TemperatureC:      int(38 + util*0.4),
+			FanSpeedPct:       int(30 + util*0.5),
+			HasFan:            true,
+			PowerDrawW:        math.Round((25+util*4)*100) / 100,
+			PowerLimitW:       450,
+			MemoryUsedMiB:     usedMiB,
+			MemoryTotalMiB:    24564,
+			MemoryFreeMiB:     24564 - usedMiB,
+			MemoryReservedMiB: usedMiB - procMiB,
+			GPUUtilizationPct: int(util),
+			MemUtilizationPct: int(util * 0.6),
+			PState:            "P2",
+			PCIEGenCurrent:    4,
+			PCIEGenMax:        4,
+			ComputeCapability: "8.9",
+			Architecture:      architectureName("8.9"),
+			Processes: []GPUProcess{{
+				PID:           4200 + i,
+				ProcessName:   "/usr/local/bin/ollama",
+				UsedMemoryMiB: procMiB,
+			}},
+
+			TemperatureAvailable:    true,
+			PowerDrawAvailable:      true,
+			PowerLimitAvailable:     true,
+			GPUUtilizationAvailable: true,
+			MemUtilizationAvailable: true,
+		})
+	}
+	return metrics
+}
+
+func mockOllamaStats(now time.Time) (*OllamaStats, *ModelCatalog) {
+	ts := now.UTC().Format(time.RFC3339)
+	expires := now.Add(4 * time.Minute).UTC().Format(time.RFC3339Nano)
+
+	catalog := &ModelCatalog{
+		Timestamp: ts,
+		Models: []AvailableModel{
+			{Name: "llama3.1:8b", SizeBytes: 4920753328, ParameterSize: "8.0B", Quantization: "Q4_K_M", Family: "llama", ModifiedAt: "2024-07-24T12:00:00Z"},
+			{Name: "qwen2.5:14b", SizeBytes: 8988124069, ParameterSize: "14.8B", Quantization: "Q4_K_M", Family: "qwen2", ModifiedAt: "2024-09-19T12:00:00Z"},
+			{Name: "nomic-embed-text:latest", SizeBytes: 274302450, ParameterSize: "137M", Quantization: "F16", Family: "nomic-bert", ModifiedAt: "2024-02-15T12:00:00Z"},
+		},
+	}
+	stats := &OllamaStats{
+		Timestamp:            ts,
+		Running:              true,
+		Version:              "0.5.7",
+		RunningModels:        []RunningModel{},
+		AvailableModelsCount: len(catalog.Models),
+	}
+	for i := range catalog.Models {
+		c := &catalog.Models[i]
+		c.BaseName, c.Tag = splitModelName(c.Name)
+		stats.TotalDiskUsageBytes += c.SizeBytes
+	}
+
+	const llamaKV = 1 << 30  // 32 layers * 8 KV heads * 128 dims * 2 * f16 * 8192 tokens
+	const llamaAct = 1 << 29 // 32 heads * 8192 tokens * 512 batch * f32
+	stats.RunningModels = append(stats.RunningModels,
+		RunningModel{
+			Name:          "llama3.1:8b",
+			SizeVRAMBytes: 6654289920,
+			ParameterSize: "8.0B",
+			Quantization:  "Q4_K_M",
+			Family:        "llama",
+			ExpiresAt:     expires,
+			ContextWindow: 8192,
+			KVCache: KVCacheInfo{
+				DType:         "f16",
+				AssumedDType:  "f16",
+				BytesPerToken: 131072,
+				MaxSizeBytes:  llamaKV,
+				MaxSizeMiB:    1024,
+
+				CurrentUsedBytes: llamaKV,
+
+				Layers:          32,
+				KVHeads:         8,
+				KeyLength:       128,
+				ValueLength:     128,
+				BytesPerElement: 2,
+				Tokens:          8192,
+			},
+			VRAM: VRAMBreakdown{
+				TotalBytes:         6654289920,
+				WeightsEstBytes:    6654289920 - llamaKV - llamaAct,
+				KVCacheMaxBytes:    llamaKV,
+				ActivationEstBytes: llamaAct,
+			},
+		},
+		RunningModel{
+			Name:          "nomic-embed-text:latest",
+			SizeVRAMBytes: 849346560,
+			ParameterSize: "137M",
+			Quantization:  "F16",
+			Family:        "nomic-bert",
+			ExpiresAt:     expires,
+			ContextWindow: 2048,
+			IsEmbedding:   true,
+			VRAM: VRAMBreakdown{
+				TotalBytes:      849346560,
+				WeightsEstBytes: 849346560,
+			},
+		},
+	)
+	for i := range stats.RunningModels {
+		rm := &stats.RunningModels[i]
+		rm.BaseName, rm.Tag = splitModelName(rm.Name)
+		rm.KeepAliveSeconds, rm.KeepAliveSource = keepAlive(rm.ExpiresAt, "", now)
+	}
+	return stats, catalog
+}
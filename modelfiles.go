@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A local Ollama server keeps each model as a manifest under
+// <models>/manifests/<registry>/<namespace>/<model>/<tag> listing
+// content-addressed blobs stored in <models>/blobs.
+
+const ollamaWeightsMediaType = "application/vnd.ollama.image.model"
+
+type ollamaManifest struct {
+	Config ollamaManifestLayer   `json:"config"`
+	Layers []ollamaManifestLayer `json:"layers"`
+}
+
+type ollamaManifestLayer struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// ollamaModelsDir returns the local server's models directory: its
+// OLLAMA_MODELS setting, ours, or the first default location that exists.
+// It returns "" when none is readable from this process.
+func ollamaModelsDir(serverEnv map[string]string) string {
+	candidates := []string{serverEnv["OLLAMA_MODELS"], os.Getenv("OLLAMA_MODELS")}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".ollama", "models"))
+	}
+	candidates = append(candidates, "/usr/share/ollama/.ollama/models")
+	for _, dir := range candidates {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.ReadDir(filepath.Join(dir, "manifests")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// manifestPath maps a model name such as "llama3.1:8b" or
+// "hf.co/org/model:Q4_K_M" to its manifest file under dir.
+func manifestPath(dir, name string) string {
+	base, tag := name, "latest"
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		base, tag = name[:i], name[i+1:]
+	}
+	parts := strings.Split(base, "/")
+	switch len(parts) {
+	case 1:
+		parts = []string{"registry.ollama.ai", "library", parts[0]}
+	case 2:
+		parts = append([]string{"registry.ollama.ai"}, parts...)
+	}
+	return filepath.Join(append(append([]string{dir, "manifests"}, parts...), tag)...)
+}
+
+// modelFiles returns the path of a model's weights blob and the total
+// on-disk size of all its blobs. The path is "" if the manifest can't be
+// read.
+func modelFiles(dir, name string) (path string, size int64) {
+	data, err := os.ReadFile(manifestPath(dir, name))
+	if err != nil {
+		return "", 0
+	}
+	var manifest ollamaManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", 0
+	}
+	for _, layer := range append(manifest.Layers, manifest.Config) {
+		blob := filepath.Join(dir, "blobs", strings.Replace(layer.Digest, ":", "-", 1))
+		info, err := os.Stat(blob)
+		if err != nil {
+			continue
+		}
+		size += info.Size()
+		if layer.MediaType == ollamaWeightsMediaType {
+			path = blob
+		}
+	}
+	return path, size
+}
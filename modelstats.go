@@ -0,0 +1,149 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTrackedModels bounds modelUsage; past it the model seen longest ago
+// is forgotten.
+const maxTrackedModels = 256
+
+// ModelUsage is the load history of one model since startup.
+type ModelUsage struct {
+	Name string `json:"name"`
+	// Loads counts the polls that found the model loaded after a poll
+	// that didn't. A model unloaded and reloaded between two polls isn't
+	// noticed.
+	Loads           int     `json:"loads"`
+	Loaded          bool    `json:"loaded"`
+	ResidentSeconds float64 `json:"resident_seconds"`
+	// AvgResidentSeconds is ResidentSeconds per load.
+	AvgResidentSeconds float64 `json:"avg_resident_seconds"`
+	AvgSizeVRAMBytes   int64   `json:"avg_size_vram_bytes"`
+	MaxSizeVRAMBytes   int64   `json:"max_size_vram_bytes"`
+	LastLoadedAt       string  `json:"last_loaded_at"`
+	LastSeenAt         string  `json:"last_seen_at"`
+}
+
+type ModelUsageStats struct {
+	Timestamp string       `json:"timestamp"`
+	Since     string       `json:"since"`
+	Models    []ModelUsage `json:"models"`
+}
+
+type modelUsageAcc struct {
+	loads          int
+	resident       time.Duration
+	vramSum        int64
+	vramSamples    int64
+	vramMax        int64
+	lastLoaded     time.Time
+	lastSeen       time.Time
+	loadedLastPoll bool
+}
+
+// modelUsage accumulates ModelUsage from successive Ollama polls.
+type modelUsage struct {
+	maxGap time.Duration // longest time one poll is credited for
+
+	mu       sync.Mutex
+	since    time.Time
+	lastPoll time.Time
+	models   map[string]*modelUsageAcc
+}
+
+func newModelUsage(interval time.Duration) *modelUsage {
+	return &modelUsage{
+		maxGap: 2 * interval,
+		since:  time.Now(),
+		models: make(map[string]*modelUsageAcc),
+	}
+}
+
+// observe records the models loaded at now. Polls that couldn't reach
+// Ollama say nothing about what is loaded and are skipped.
+func (u *modelUsage) observe(now time.Time, stats *OllamaStats) {
+	if !stats.Running {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	elapsed := min(now.Sub(u.lastPoll), u.maxGap)
+	u.lastPoll = now
+	loaded := make(map[string]bool, len(stats.RunningModels))
+	for _, rm := range stats.RunningModels {
+		loaded[rm.Name] = true
+		acc := u.models[rm.Name]
+		if acc == nil {
+			// Seen now, so the eviction doesn't pick it.
+			acc = &modelUsageAcc{lastSeen: now}
+			u.models[rm.Name] = acc
+			u.evict()
+		}
+		if acc.loadedLastPoll {
+			acc.resident += elapsed
+		} else {
+			acc.loads++
+			acc.lastLoaded = now
+		}
+		acc.loadedLastPoll = true
+		acc.lastSeen = now
+		acc.vramSum += rm.SizeVRAMBytes
+		acc.vramSamples++
+		acc.vramMax = max(acc.vramMax, rm.SizeVRAMBytes)
+	}
+	for name, acc := range u.models {
+		if !loaded[name] {
+			acc.loadedLastPoll = false
+		}
+	}
+}
+
+// evict drops the model seen longest ago once more than maxTrackedModels
+// are tracked.
+func (u *modelUsage) evict() {
+	if len(u.models) <= maxTrackedModels {
+		return
+	}
+	oldest := ""
+	for name, acc := range u.models {
+		if oldest == "" || acc.lastSeen.Before(u.models[oldest].lastSeen) {
+			oldest = name
+		}
+	}
+	delete(u.models, oldest)
+}
+
+func (u *modelUsage) snapshot() *ModelUsageStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := &ModelUsageStats{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Since:     u.since.UTC().Format(time.RFC3339),
+		Models:    []ModelUsage{},
+	}
+	for name, acc := range u.models {
+		mu := ModelUsage{
+			Name:             name,
+			Loads:            acc.loads,
+			Loaded:           acc.loadedLastPoll,
+			ResidentSeconds:  round2(acc.resident.Seconds()),
+			MaxSizeVRAMBytes: acc.vramMax,
+			LastLoadedAt:     acc.lastLoaded.UTC().Format(time.RFC3339),
+			LastSeenAt:       acc.lastSeen.UTC().Format(time.RFC3339),
+		}
+		if acc.loads > 0 {
+			mu.AvgResidentSeconds = round2(acc.resident.Seconds() / float64(acc.loads))
+		}
+		if acc.vramSamples > 0 {
+			mu.AvgSizeVRAMBytes = acc.vramSum / acc.vramSamples
+		}
+		out.Models = append(out.Models, mu)
+	}
+	slices.SortFunc(out.Models, func(a, b ModelUsage) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestModelUsageEvictsOldest(t *testing.T) {
+	u := newModelUsage(5 * time.Second)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := range maxTrackedModels + 2 {
+		now = now.Add(5 * time.Second)
+		u.observe(now, &OllamaStats{Running: true, RunningModels: []RunningModel{{Name: fmt.Sprintf("model%d:8b", i)}}})
+	}
+	if len(u.models) != maxTrackedModels {
+		t.Errorf("tracking %d models, want %d", len(u.models), maxTrackedModels)
+	}
+	for _, name := range []string{"model0:8b", "model1:8b"} {
+		if u.models[name] != nil {
+			t.Errorf("%s, seen longest ago, is still tracked", name)
+		}
+	}
+	last := fmt.Sprintf("model%d:8b", maxTrackedModels+1)
+	if acc := u.models[last]; acc == nil || acc.loads != 1 {
+		t.Errorf("newest model %s not tracked", last)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nvlinkRefresh is how often NVLink status is re-read, or retried after
+// a failure. Hosts without NVLink are only checked once.
+const nvlinkRefresh = 10 * time.Second
+
+var (
+	nvlinkGPURe  = regexp.MustCompile(`^GPU \d+: .*\(UUID: (GPU-[^)]+)\)`)
+	nvlinkLineRe = regexp.MustCompile(`^Link (\d+): (.*)$`)
+)
+
+// nvlinkInfo returns NVLink details keyed by GPU UUID.
+func (b *smiBackend) nvlinkInfo() map[string][]NVLinkInfo {
+	if b.noNVLink || time.Since(b.nvlinkChecked) < nvlinkRefresh {
+		return b.nvlinks
+	}
+	b.nvlinkChecked = time.Now()
+	status, err := b.runSubcommand("nvlink", "--status")
+	if err != nil {
+		// Not the same as no NVLink: try again after nvlinkRefresh.
+		log.Println("nvidia-smi nvlink --status:", err)
+		return b.nvlinks
+	}
+	links := parseNVLinkStatus(string(status))
+	if len(links) > 0 {
+		// Error counters are best-effort; older drivers lack -e.
+		if counters, err := b.runSubcommand("nvlink", "-e"); err == nil {
+			parseNVLinkErrors(string(counters), links)
+		}
+	}
+	b.nvlinks, b.noNVLink = links, len(links) == 0
+	return b.nvlinks
+}
+
+// nvlinkSections splits nvlink output into per-GPU "Link N: ..." lines.
+func nvlinkSections(out string, fn func(uuid string, link int, rest string)) {
+	uuid := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if m := nvlinkGPURe.FindStringSubmatch(line); m != nil {
+			uuid = m[1]
+			continue
+		}
+		m := nvlinkLineRe.FindStringSubmatch(line)
+		if m == nil || uuid == "" {
+			continue
+		}
+		link, _ := strconv.Atoi(m[1])
+		fn(uuid, link, strings.TrimSpace(m[2]))
+	}
+}
+
+// parseNVLinkStatus parses `nvidia-smi nvlink --status`, whose link lines
+// look like "Link 0: 25 GB/s" or "Link 1: <inactive>".
+func parseNVLinkStatus(out string) map[string][]NVLinkInfo {
+	links := make(map[string][]NVLinkInfo)
+	nvlinkSections(out, func(uuid string, link int, rest string) {
+		info := NVLinkInfo{Link: link, State: "down"}
+		if bw, ok := strings.CutSuffix(rest, " GB/s"); ok {
+			if v, err := parseFloatErr(bw); err == nil {
+				info.State = "up"
+				info.BandwidthGBs = v
+			}
+		}
+		links[uuid] = append(links[uuid], info)
+	})
+	return links
+}
+
+// parseNVLinkErrors adds the counters from `nvidia-smi nvlink -e`, whose
+// lines look like "Link 0: Replay Errors: 0".
+func parseNVLinkErrors(out string, links map[string][]NVLinkInfo) {
+	nvlinkSections(out, func(uuid string, link int, rest string) {
+		name, value, ok := strings.Cut(rest, ":")
+		if !ok {
+			return
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return
+		}
+		for i := range links[uuid] {
+			l := &links[uuid][i]
+			if l.Link != link {
+				continue
+			}
+			switch strings.TrimSpace(name) {
+			case "Replay Errors":
+				l.ReplayErrors = n
+			case "Recovery Errors":
+				l.RecoveryErrors = n
+			case "CRC Errors":
+				l.CRCErrors = n
+			}
+		}
+	})
+}
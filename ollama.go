@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Ollama API response types
@@ -37,98 +46,187 @@ type ollamaTagsResponse struct {
 }
 
 type ollamaTagModel struct {
-	Name    string             `json:"name"`
-	Size    int64              `json:"size"`
-	Details ollamaModelDetails `json:"details"`
+	Name       string             `json:"name"`
+	Size       int64              `json:"size"`
+	ModifiedAt string             `json:"modified_at"`
+	Details    ollamaModelDetails `json:"details"`
 }
 
 type ollamaShowResponse struct {
-	ModelInfo  map[string]interface{} `json:"model_info"`
-	Details    ollamaModelDetails     `json:"details"`
-	Parameters string                `json:"parameters"`
+	ModelInfo     map[string]interface{} `json:"model_info"`
+	ProjectorInfo map[string]interface{} `json:"projector_info"`
+	Details       ollamaModelDetails     `json:"details"`
+	Parameters    string                 `json:"parameters"`
+	Capabilities  []string               `json:"capabilities"`
 }
 
 type ollamaVersionResponse struct {
 	Version string `json:"version"`
 }
 
-// Public data model
+// Monitor
 
-type KVCacheInfo struct {
-	DType         string  `json:"dtype"`
-	BytesPerToken int     `json:"bytes_per_token"`
-	MaxSizeBytes  int64   `json:"max_size_bytes"`
-	MaxSizeMiB    float64 `json:"max_size_mib"`
+type OllamaMonitor struct {
+	refresh  singleflight.Group // coalesces concurrent Refresh calls
+	pollMu   sync.Mutex         // serializes polls; guards lastPoll
+	lastPoll time.Time
+
+	mu          sync.RWMutex
+	latest      *OllamaStats
+	catalog     *ModelCatalog
+	stopCh      chan struct{}
+	host        string
+	transport   http.RoundTripper // adds OLLAMA_HEADERS, if set
+	client      *http.Client
+	interval    time.Duration
+	jitter      float64
+	showRefresh time.Duration
+	showTimeout time.Duration
+	showClient  *http.Client // without a client timeout; see fetchShow
+	showLimit   int          // concurrent /api/show calls per poll
+	showMu      sync.Mutex   // guards showCache
+	showCache   map[string]showCacheEntry
+	mock        bool
+
+	// Assumed KV cache settings of the Ollama server; see kvCacheSettings.
+	kvCacheType string
+	flashAttn   bool
+
+	gpuSource func() *GPUMetrics // for model placement; nil if unset
+	usage     *modelUsage
+
+	// Circuit breaker: after breakerFailures failed polls in a row, the
+	// poll loop only probes every backoffInterval. Guarded by pollMu.
+	breakerFailures int
+	backoffInterval time.Duration
+	failures        int
+	nextProbe       time.Time // zero unless backing off
+
+	lastSlowWarning time.Time // guarded by pollMu
 }
 
-type VRAMBreakdown struct {
-	TotalBytes      int64 `json:"total_bytes"`
-	WeightsEstBytes int64 `json:"weights_est_bytes"`
-	KVCacheMaxBytes int64 `json:"kv_cache_max_bytes"`
+// showCacheEntry is a cached /api/show response. Architecture metadata
+// practically never changes for a given tag, so entries are refreshed on
+// a much slower cadence than the /api/ps poll.
+type showCacheEntry struct {
+	show    *ollamaShowResponse
+	fetched time.Time
 }
 
-type RunningModel struct {
-	Name          string        `json:"name"`
-	SizeVRAMBytes int64         `json:"size_vram_bytes"`
-	ParameterSize string        `json:"parameter_size"`
-	Quantization  string        `json:"quantization"`
-	Family        string        `json:"family"`
-	ExpiresAt     string        `json:"expires_at"`
-	ContextWindow int           `json:"context_window"`
-	KVCache       KVCacheInfo   `json:"kv_cache"`
-	VRAM          VRAMBreakdown `json:"vram"`
+func NewOllamaMonitor(cfg *Config) *OllamaMonitor {
+	transport := http.DefaultTransport
+	if headers := parseHeaderList(cfg.OllamaHeaders); len(headers) > 0 {
+		transport = headerTransport{base: transport, headers: headers}
+	}
+	return &OllamaMonitor{
+		stopCh:      make(chan struct{}),
+		host:        normalizeOllamaHost(cfg.OllamaHost),
+		transport:   transport,
+		client:      &http.Client{Timeout: 5 * time.Second, Transport: transport},
+		interval:    cfg.OllamaPollInterval,
+		jitter:      cfg.PollJitter,
+		showRefresh: cfg.OllamaShowRefresh,
+		showTimeout: cfg.OllamaShowTimeout,
+		showClient:  &http.Client{Transport: transport},
+		showLimit:   cfg.OllamaShowConcurrency,
+		showCache:   make(map[string]showCacheEntry),
+		mock:        cfg.Mock,
+		usage:       newModelUsage(cfg.OllamaPollInterval),
+		kvCacheType: cfg.OllamaKVCacheType,
+		flashAttn:   cfg.OllamaFlashAttention,
+
+		breakerFailures: cfg.OllamaBreakerFailures,
+		backoffInterval: cfg.OllamaBackoffInterval,
+	}
 }
 
-type OllamaStats struct {
-	Timestamp            string         `json:"timestamp"`
-	Running              bool           `json:"running"`
-	Version              string         `json:"version"`
-	RunningModels        []RunningModel `json:"running_models"`
-	AvailableModelsCount int            `json:"available_models_count"`
-	TotalDiskUsageBytes  int64          `json:"total_disk_usage_bytes"`
+// normalizeOllamaHost turns OLLAMA_HOST into a base URL that API paths
+// can be appended to: it adds a missing scheme and drops trailing slashes,
+// which would otherwise produce "//api/..." paths. A path component is
+// kept, for an Ollama behind a reverse proxy prefix, but logged since it
+// is usually a mistake.
+func normalizeOllamaHost(host string) string {
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		log.Printf("invalid OLLAMA_HOST=%q: %v", host, err)
+		return strings.TrimRight(host, "/")
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	if u.Path != "" {
+		log.Printf("OLLAMA_HOST has a path (%s); API requests go to %s/api/...", u.Path, u.String())
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		log.Printf("ignoring query and fragment in OLLAMA_HOST=%q", host)
+		u.RawQuery, u.Fragment = "", ""
+	}
+	return u.String()
 }
 
-// Monitor
+// ModelUsage returns per-model load statistics since startup.
+func (m *OllamaMonitor) ModelUsage() *ModelUsageStats {
+	return m.usage.snapshot()
+}
 
-type OllamaMonitor struct {
-	mu        sync.RWMutex
-	latest    *OllamaStats
-	stopCh    chan struct{}
-	host      string
-	client    *http.Client
-	showCache map[string]*ollamaShowResponse
+// Host returns the Ollama API address, e.g. "http://localhost:11434".
+func (m *OllamaMonitor) Host() string {
+	return m.host
 }
 
-func NewOllamaMonitor() *OllamaMonitor {
-	host := os.Getenv("OLLAMA_HOST")
-	if host == "" {
-		host = "http://localhost:11434"
-	}
-	if !strings.HasPrefix(host, "http") {
-		host = "http://" + host
+// Transport returns the transport used for requests to Ollama.
+func (m *OllamaMonitor) Transport() http.RoundTripper {
+	return m.transport
+}
+
+// headerTransport sets fixed headers on every request, for an Ollama
+// behind a gateway that routes or authenticates on them.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for key, values := range t.headers {
+		r.Header[key] = values
 	}
-	return &OllamaMonitor{
-		stopCh:    make(chan struct{}),
-		host:      host,
-		client:    &http.Client{Timeout: 5 * time.Second},
-		showCache: make(map[string]*ollamaShowResponse),
+	return t.base.RoundTrip(r)
+}
+
+// parseHeaderList parses OLLAMA_HEADERS, "Key1:Val1;Key2:Val2". Entries
+// without a colon or name are logged and skipped.
+func parseHeaderList(s string) http.Header {
+	headers := make(http.Header)
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			log.Printf("OLLAMA_HEADERS: ignoring %q, want Key:Value", entry)
+			continue
+		}
+		headers.Add(key, strings.TrimSpace(value))
 	}
+	return headers
+}
+
+// SetGPUSource gives the monitor access to GPU snapshots, used to infer
+// which GPUs each running model occupies. Call it before Start.
+func (m *OllamaMonitor) SetGPUSource(fn func() *GPUMetrics) {
+	m.gpuSource = fn
 }
 
 func (m *OllamaMonitor) Start() {
 	m.poll()
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				m.poll()
-			case <-m.stopCh:
-				return
-			}
-		}
-	}()
+	go pollEvery(m.interval, m.jitter, m.stopCh, m.poll)
 }
 
 func (m *OllamaMonitor) Stop() {
@@ -141,27 +239,120 @@ func (m *OllamaMonitor) Latest() *OllamaStats {
 	return m.latest
 }
 
+// Catalog returns the models available on the Ollama host as of the last
+// poll.
+func (m *OllamaMonitor) Catalog() *ModelCatalog {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.catalog
+}
+
+// poll is the scheduled poll. While the breaker is open it skips polls
+// until the next probe is due; Refresh always polls.
 func (m *OllamaMonitor) poll() {
-	stats := m.fetch()
+	m.pollMu.Lock()
+	defer m.pollMu.Unlock()
+	if !m.nextProbe.IsZero() && time.Now().Before(m.nextProbe) {
+		return
+	}
+	m.pollLocked()
+}
+
+// Refresh polls Ollama now, unless the last poll started less than minAge
+// before the call, and returns the resulting stats. Concurrent callers
+// share a single poll.
+func (m *OllamaMonitor) Refresh(minAge time.Duration) *OllamaStats {
+	oldest := time.Now().Add(-minAge)
+	m.refresh.Do("poll", func() (any, error) {
+		m.pollMu.Lock()
+		defer m.pollMu.Unlock()
+		if m.lastPoll.Before(oldest) {
+			m.pollLocked()
+		}
+		return nil, nil
+	})
+	// The shared poll may have started before this call, or been skipped
+	// under another caller's minAge; if it's too old, poll again.
+	m.pollMu.Lock()
+	if m.lastPoll.Before(oldest) {
+		m.pollLocked()
+	}
+	m.pollMu.Unlock()
+	return m.Latest()
+}
+
+func (m *OllamaMonitor) pollLocked() {
+	m.lastPoll = time.Now()
+	stats, catalog := m.fetch()
+	took := time.Since(m.lastPoll)
+	stats.FetchDurationMs = durationMs(took)
+	stats.SchemaVersion = schemaVersion
+	warnSlowPoll(&m.lastSlowWarning, "ollama", took, m.interval)
+	m.updateBreaker(stats)
+	if m.gpuSource != nil {
+		placeModels(stats, m.gpuSource())
+	}
+	m.usage.observe(time.Now(), stats)
 	m.mu.Lock()
 	m.latest = stats
+	m.catalog = catalog
 	m.mu.Unlock()
 }
 
-func (m *OllamaMonitor) fetch() *OllamaStats {
+// updateBreaker counts consecutive polls that found Ollama unreachable
+// and opens or closes the breaker accordingly.
+func (m *OllamaMonitor) updateBreaker(stats *OllamaStats) {
+	if stats.Running {
+		if !m.nextProbe.IsZero() {
+			log.Printf("ollama reachable again at %s, resuming %s polls", m.host, m.interval)
+		}
+		m.failures, m.nextProbe = 0, time.Time{}
+		stats.ProbeState = "normal"
+		return
+	}
+	m.failures++
+	if m.breakerFailures > 0 && m.failures >= m.breakerFailures {
+		if m.nextProbe.IsZero() {
+			log.Printf("ollama unreachable at %s for %d polls, probing every %s", m.host, m.failures, m.backoffInterval)
+		}
+		m.nextProbe = time.Now().Add(m.backoffInterval)
+		stats.ProbeState = "backoff"
+		return
+	}
+	stats.ProbeState = "normal"
+}
+
+func (m *OllamaMonitor) fetch() (*OllamaStats, *ModelCatalog) {
+	if m.mock {
+		return mockOllamaStats(time.Now())
+	}
+
+	now := time.Now()
 	stats := &OllamaStats{
-		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Timestamp:     now.UTC().Format(time.RFC3339),
 		RunningModels: []RunningModel{},
 	}
+	catalog := &ModelCatalog{
+		Timestamp: stats.Timestamp,
+		Models:    []AvailableModel{},
+	}
 
 	// Liveness
 	resp, err := m.client.Get(m.host + "/")
 	if err != nil {
-		return stats
+		return stats, catalog
 	}
 	resp.Body.Close()
 	stats.Running = true
 
+	var serverEnv map[string]string
+	if isLocalHost(m.host) {
+		serverEnv = ollamaServerEnv()
+		stats.MaxParallel = envMapInt(serverEnv, "OLLAMA_NUM_PARALLEL")
+		stats.MaxLoadedModels = envMapInt(serverEnv, "OLLAMA_MAX_LOADED_MODELS")
+		catalog.ModelsDir = ollamaModelsDir(serverEnv)
+	}
+
 	// Version
 	var ver ollamaVersionResponse
 	if err := m.getJSON("/api/version", &ver); err == nil {
@@ -170,76 +361,114 @@ func (m *OllamaMonitor) fetch() *OllamaStats {
 
 	// Available models
 	var tags ollamaTagsResponse
+	pulledSize := make(map[string]int64)
 	if err := m.getJSON("/api/tags", &tags); err == nil {
 		stats.AvailableModelsCount = len(tags.Models)
 		for _, t := range tags.Models {
 			stats.TotalDiskUsageBytes += t.Size
+			pulledSize[t.Name] = t.Size
+			baseName, tag := splitModelName(t.Name)
+			am := AvailableModel{
+				Name:          t.Name,
+				BaseName:      baseName,
+				Tag:           tag,
+				SizeBytes:     t.Size,
+				ParameterSize: t.Details.ParameterSize,
+				Quantization:  t.Details.QuantizationLevel,
+				Family:        t.Details.Family,
+				ModifiedAt:    t.ModifiedAt,
+			}
+			if catalog.ModelsDir != "" {
+				am.Path, am.DiskSizeBytes = modelFiles(catalog.ModelsDir, t.Name)
+			}
+			catalog.Models = append(catalog.Models, am)
 		}
 	}
 
 	// Running models
 	var ps ollamaPsResponse
 	if err := m.getJSON("/api/ps", &ps); err != nil {
-		return stats
+		return stats, catalog
 	}
 
-	kvDtype := os.Getenv("OLLAMA_KV_CACHE_TYPE")
-	if kvDtype == "" {
-		kvDtype = "f16"
+	assumedDtype, detectedDtype, kvDtype, flashAttn := kvCacheSettings(serverEnv, m.kvCacheType, m.flashAttn)
+
+	names := make([]string, len(ps.Models))
+	for i, model := range ps.Models {
+		names[i] = model.Name
 	}
+	shows := m.getShows(names)
 
-	for _, model := range ps.Models {
+	for i, model := range ps.Models {
+		baseName, tag := splitModelName(model.Name)
 		rm := RunningModel{
 			Name:          model.Name,
+			BaseName:      baseName,
+			Tag:           tag,
 			SizeVRAMBytes: model.SizeVRAM,
 			ParameterSize: model.Details.ParameterSize,
 			Quantization:  model.Details.QuantizationLevel,
 			Family:        model.Details.Family,
 			ExpiresAt:     model.ExpiresAt,
 		}
+		rm.KeepAliveSeconds, rm.KeepAliveSource = keepAlive(model.ExpiresAt, "", now)
 
-		show := m.getShow(model.Name)
+		show := shows[i]
 		if show != nil {
+			if v := paramValue(show.Parameters, "keep_alive"); v != "" {
+				rm.KeepAliveSeconds, rm.KeepAliveSource = keepAlive(model.ExpiresAt, v, now)
+			}
 			arch := modelInfoString(show.ModelInfo, "general.architecture")
 			if arch == "" {
 				arch = model.Details.Family
 			}
-
-			nLayers := modelInfoInt(show.ModelInfo, arch+".block_count")
-			nHeads := modelInfoInt(show.ModelInfo, arch+".attention.head_count")
-			nKVHeads := modelInfoInt(show.ModelInfo, arch+".attention.head_count_kv")
-			embLen := modelInfoInt(show.ModelInfo, arch+".embedding_length")
-			ctxLen := modelInfoInt(show.ModelInfo, arch+".context_length")
-
-			if numCtx := paramInt(show.Parameters, "num_ctx"); numCtx > 0 {
-				ctxLen = numCtx
+			// /api/ps leaves these empty for some models.
+			if rm.ParameterSize == "" {
+				rm.ParameterSize = show.Details.ParameterSize
+			}
+			if rm.ParameterSize == "" {
+				rm.ParameterSize = formatParamCount(modelInfoInt(show.ModelInfo, "general.parameter_count"))
+			}
+			if rm.Quantization == "" {
+				rm.Quantization = show.Details.QuantizationLevel
 			}
-			if ctxLen == 0 {
-				ctxLen = 2048
+			if rm.Quantization == "" {
+				rm.Quantization = fileTypeName(show.ModelInfo)
 			}
-			rm.ContextWindow = ctxLen
-
-			if nLayers > 0 && nKVHeads > 0 && nHeads > 0 && embLen > 0 {
-				headDim := embLen / nHeads
-				bytesPerElem := kvDtypeBytesPerElement(kvDtype)
-				bytesPerToken := int(float64(2*nLayers*nKVHeads*headDim) * bytesPerElem)
-				maxBytes := int64(bytesPerToken) * int64(ctxLen)
-
-				rm.KVCache = KVCacheInfo{
-					DType:         kvDtype,
-					BytesPerToken: bytesPerToken,
-					MaxSizeBytes:  maxBytes,
-					MaxSizeMiB:    float64(maxBytes) / (1024 * 1024),
+			rm.IsEmbedding = isEmbeddingModel(show, arch)
+			rm.IsMultimodal = isMultimodalModel(show, arch)
+
+			var kvTokens int
+			rm.ContextWindow, rm.SlidingWindow, kvTokens = contextTokens(show, arch, rm.IsEmbedding)
+
+			if rm.IsEmbedding {
+				// Embedding models have no causal KV cache; everything
+				// resident is weights and compute buffers.
+				rm.VRAM = VRAMBreakdown{
+					TotalBytes:      model.SizeVRAM,
+					WeightsEstBytes: model.SizeVRAM,
+				}
+			} else if kv, activation, ok := estimateKVCache(show.ModelInfo, arch, kvTokens, kvDtype, flashAttn, model.SizeVRAM); ok {
+				kv.AssumedDType = assumedDtype
+				kv.DetectedDType = detectedDtype
+				kv.DTypeMismatch = detectedDtype != "" && detectedDtype != assumedDtype
+				// The pulled size is a weights estimate independent of the
+				// cache, but only comparable when nothing is offloaded.
+				if weights, ok := pulledSize[model.Name]; ok && model.SizeVRAM >= model.Size {
+					kv.CurrentUsedBytes = min(max(model.SizeVRAM-weights-activation, 0), kv.MaxSizeBytes)
 				}
+				rm.KVCache = kv
+				maxBytes := kv.MaxSizeBytes
 
-				weightsEst := model.SizeVRAM - maxBytes
+				weightsEst := model.SizeVRAM - maxBytes - activation
 				if weightsEst < 0 {
 					weightsEst = model.Size
 				}
 				rm.VRAM = VRAMBreakdown{
-					TotalBytes:      model.SizeVRAM,
-					WeightsEstBytes: weightsEst,
-					KVCacheMaxBytes: maxBytes,
+					TotalBytes:         model.SizeVRAM,
+					WeightsEstBytes:    weightsEst,
+					KVCacheMaxBytes:    maxBytes,
+					ActivationEstBytes: activation,
 				}
 			}
 		}
@@ -247,7 +476,71 @@ func (m *OllamaMonitor) fetch() *OllamaStats {
 		stats.RunningModels = append(stats.RunningModels, rm)
 	}
 
-	return stats
+	return stats, catalog
+}
+
+// kvCacheSettings returns the KV cache type and FlashAttention setting to
+// estimate with. Our OLLAMA_KV_CACHE_TYPE and OLLAMA_FLASH_ATTENTION,
+// assumed and assumedFlash, are only assumptions; a local server's own
+// settings, from serverEnv, win.
+func kvCacheSettings(serverEnv map[string]string, assumed string, assumedFlash bool) (_, detected, dtype string, flashAttn bool) {
+	detected = detectKVCacheType(serverEnv)
+	dtype = assumed
+	if detected != "" {
+		dtype = detected
+	}
+	flashAttn, known := detectFlashAttention(serverEnv)
+	if !known {
+		flashAttn = assumedFlash
+	}
+	return assumed, detected, dtype, flashAttn
+}
+
+// contextTokens returns a model's context window (num_ctx if set), its
+// sliding attention window if any, and the number of tokens its KV cache
+// holds: with sliding-window attention only the last window is kept,
+// regardless of the context length.
+func contextTokens(show *ollamaShowResponse, arch string, embedding bool) (ctxLen, sliding, kvTokens int) {
+	ctxLen = modelInfoInt(show.ModelInfo, arch+".context_length")
+	if numCtx := paramInt(show.Parameters, "num_ctx"); numCtx > 0 {
+		ctxLen = numCtx
+	}
+	if !inRange(ctxLen, maxContextLength) {
+		ctxLen = 0
+	}
+	if ctxLen == 0 && !embedding {
+		ctxLen = 2048
+	}
+	sliding = modelInfoInt(show.ModelInfo, arch+".attention.sliding_window")
+	kvTokens = ctxLen
+	if sliding > 0 && sliding < kvTokens {
+		kvTokens = sliding
+	}
+	return ctxLen, sliding, kvTokens
+}
+
+// Unload asks Ollama to unload a model by sending a generate request with
+// keep_alive 0, Ollama's documented way to evict a model.
+func (m *OllamaMonitor) Unload(ctx context.Context, name string) error {
+	if m.mock {
+		return nil
+	}
+	body := fmt.Sprintf(`{"model":%q,"keep_alive":0}`, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.host+"/api/generate", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("ollama: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
 }
 
 func (m *OllamaMonitor) getJSON(path string, v interface{}) error {
@@ -259,27 +552,119 @@ func (m *OllamaMonitor) getJSON(path string, v interface{}) error {
 	return json.NewDecoder(resp.Body).Decode(v)
 }
 
+// getShows returns getShow for each of names, running at most showLimit
+// requests at a time so a small Ollama host isn't swamped when many
+// models are loaded.
+func (m *OllamaMonitor) getShows(names []string) []*ollamaShowResponse {
+	shows := make([]*ollamaShowResponse, len(names))
+	var g errgroup.Group
+	g.SetLimit(m.showLimit)
+	for i, name := range names {
+		g.Go(func() error {
+			shows[i] = m.getShow(name)
+			return nil
+		})
+	}
+	g.Wait()
+	return shows
+}
+
+// getShow returns the /api/show response for a model, refetching it once
+// the cached copy is older than showRefresh. A timed-out request is
+// retried once; if the refresh still fails the stale copy, if any, is
+// kept and the next poll tries again.
 func (m *OllamaMonitor) getShow(name string) *ollamaShowResponse {
-	if cached, ok := m.showCache[name]; ok {
-		return cached
+	m.showMu.Lock()
+	cached, ok := m.showCache[name]
+	m.showMu.Unlock()
+	if ok && time.Since(cached.fetched) < m.showRefresh {
+		return cached.show
+	}
+	show, err := m.fetchShow(name)
+	if isTimeout(err) {
+		show, err = m.fetchShow(name)
 	}
+	if err != nil {
+		log.Printf("ollama /api/show %s: %v", name, err)
+		return cached.show
+	}
+	m.showMu.Lock()
+	m.showCache[name] = showCacheEntry{show: show, fetched: time.Now()}
+	m.showMu.Unlock()
+	return show
+}
+
+// fetchShow calls /api/show with verbose output. That can take much longer
+// than the other calls for a large model on a cold server, so it has its
+// own OLLAMA_SHOW_TIMEOUT instead of the client's.
+func (m *OllamaMonitor) fetchShow(name string) (*ollamaShowResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.showTimeout)
+	defer cancel()
 	body := fmt.Sprintf(`{"model":%q,"verbose":true}`, name)
-	resp, err := m.client.Post(m.host+"/api/show", "application/json", strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.host+"/api/show", strings.NewReader(body))
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.showClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
-
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("ollama: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
 	var show ollamaShowResponse
 	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
-		return nil
+		return nil, err
 	}
-	m.showCache[name] = &show
-	return &show
+	return &show, nil
+}
+
+// isTimeout reports whether err is a request timing out.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // Helpers
 
+// formatParamCount formats a parameter count the way Ollama does, e.g.
+// 8030261248 as "8.0B". It returns "" for 0.
+func formatParamCount(n int) string {
+	switch {
+	case n <= 0:
+		return ""
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.0fM", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.0fK", float64(n)/1e3)
+	}
+	return strconv.Itoa(n)
+}
+
+// ggufFileTypes names the GGUF general.file_type values (llama.cpp's
+// llama_ftype) that Ollama models use.
+var ggufFileTypes = map[int]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M",
+	16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S",
+	22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16",
+}
+
+// fileTypeName returns the quantization named by general.file_type, or "".
+func fileTypeName(info map[string]interface{}) string {
+	v, ok := info["general.file_type"].(float64)
+	if !ok {
+		return ""
+	}
+	return ggufFileTypes[int(v)]
+}
+
 func modelInfoInt(info map[string]interface{}, key string) int {
 	v, ok := info[key]
 	if !ok {
@@ -302,23 +687,111 @@ func modelInfoString(info map[string]interface{}, key string) string {
 	return s
 }
 
-func kvDtypeBytesPerElement(dtype string) float64 {
-	switch dtype {
-	case "q4_0":
-		return 0.5625 // 18 bytes per block of 32
-	case "q8_0":
-		return 1.0625 // 34 bytes per block of 32
-	default: // f16
-		return 2.0
+func hasCapability(show *ollamaShowResponse, c string) bool {
+	for _, have := range show.Capabilities {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmbeddingModel reports whether the model only produces embeddings.
+// Newer Ollama versions list capabilities; older ones are detected from
+// GGUF metadata (pooling is only defined for embedding models).
+func isEmbeddingModel(show *ollamaShowResponse, arch string) bool {
+	if len(show.Capabilities) > 0 {
+		return hasCapability(show, "embedding") && !hasCapability(show, "completion")
+	}
+	if modelInfoString(show.ModelInfo, "general.type") == "embedding" {
+		return true
+	}
+	_, pooling := show.ModelInfo[arch+".pooling_type"]
+	return pooling
+}
+
+// isMultimodalModel reports whether the model carries a vision tower or
+// projector alongside the text model.
+func isMultimodalModel(show *ollamaShowResponse, arch string) bool {
+	if hasCapability(show, "vision") || len(show.ProjectorInfo) > 0 {
+		return true
 	}
+	for key := range show.ModelInfo {
+		if strings.HasPrefix(key, arch+".vision.") || strings.HasPrefix(key, "clip.") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitModelName splits an Ollama model reference such as
+// "registry.ollama.ai/library/llama3:latest" into its base name ("llama3")
+// and tag ("latest"). The default registry host and "library/" namespace
+// are dropped; other namespaces are kept as part of the base name.
+func splitModelName(name string) (base, tag string) {
+	base = name
+	if i := strings.LastIndex(base, ":"); i > strings.LastIndex(base, "/") {
+		base, tag = base[:i], base[i+1:]
+	}
+	// A leading path segment containing a dot or port is a registry host.
+	if i := strings.Index(base, "/"); i >= 0 && strings.ContainsAny(base[:i], ".:") {
+		base = base[i+1:]
+	}
+	base = strings.TrimPrefix(base, "library/")
+	if tag == "" {
+		tag = "latest"
+	}
+	return base, tag
 }
 
 func paramInt(params string, key string) int {
+	v, _ := parseIntErr(paramValue(params, key))
+	return v
+}
+
+// paramValue returns the value of a Modelfile parameter, or "".
+func paramValue(params string, key string) string {
 	for _, line := range strings.Split(params, "\n") {
 		parts := strings.Fields(strings.TrimSpace(line))
 		if len(parts) == 2 && parts[0] == key {
-			return parseInt(parts[1])
+			return strings.Trim(parts[1], `"`)
 		}
 	}
-	return 0
+	return ""
+}
+
+// infiniteKeepAlive is how far out expires_at must be for the model to
+// count as never unloading; Ollama sets it centuries ahead for -1.
+const infiniteKeepAlive = 100 * 365 * 24 * time.Hour
+
+// keepAlive returns a model's keep-alive in seconds and where it came
+// from. param is the model's keep_alive parameter (a duration or a number
+// of seconds); when empty, the time left until expiresAt is used, which
+// equals the configured keep-alive right after a request finishes.
+func keepAlive(expiresAt, param string, now time.Time) (int, string) {
+	if param != "" {
+		var d time.Duration
+		if n, err := strconv.Atoi(param); err == nil {
+			d = time.Duration(n) * time.Second
+		} else if d, err = time.ParseDuration(param); err != nil {
+			return 0, ""
+		}
+		if d < 0 {
+			return -1, "parameter"
+		}
+		return int(d.Seconds()), "parameter"
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, expiresAt)
+	if err != nil {
+		return 0, ""
+	}
+	left := t.Sub(now)
+	switch {
+	case left > infiniteKeepAlive:
+		return -1, "expires_at"
+	case left <= 0:
+		return 0, "expires_at"
+	}
+	return int(left.Round(time.Second).Seconds()), "expires_at"
 }
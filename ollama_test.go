@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeOllama serves the endpoints a poll calls, with models loaded
+// models, each also pulled.
+func newFakeOllama(models int) *httptest.Server {
+	return httptest.NewServer(fakeOllamaHandler(models))
+}
+
+func fakeOllamaHandler(models int) http.Handler {
+	var ps ollamaPsResponse
+	var tags ollamaTagsResponse
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	for i := range models {
+		details := ollamaModelDetails{Family: "llama", ParameterSize: "8.0B", QuantizationLevel: "Q4_K_M"}
+		name := fmt.Sprintf("model%d:8b", i)
+		ps.Models = append(ps.Models, ollamaPsModel{Name: name, Model: name, Size: 6 << 30, SizeVRAM: 6 << 30, Details: details, ExpiresAt: expires})
+		tags.Models = append(tags.Models, ollamaTagModel{Name: name, Size: 5 << 30, ModifiedAt: "2024-07-24T12:00:00Z", Details: details})
+	}
+	show := map[string]any{
+		"parameters": "stop \"<|eot_id|>\"",
+		"details":    map[string]string{"family": "llama", "parameter_size": "8.0B", "quantization_level": "Q4_K_M"},
+		"model_info": map[string]any{
+			"general.architecture":           "llama",
+			"general.parameter_count":        8030261248,
+			"llama.block_count":              32,
+			"llama.context_length":           131072,
+			"llama.embedding_length":         4096,
+			"llama.attention.head_count":     32,
+			"llama.attention.head_count_kv":  8,
+			"llama.attention.key_length":     128,
+			"llama.attention.value_length":   128,
+			"llama.feed_forward_length":      14336,
+			"llama.rope.dimension_count":     128,
+			"llama.vocab_size":               128256,
+			"tokenizer.ggml.model":           "gpt2",
+			"tokenizer.ggml.bos_token_id":    128000,
+			"tokenizer.ggml.eos_token_id":    128009,
+			"general.quantization_version":   2,
+			"general.file_type":              15,
+			"llama.rope.freq_base":           500000,
+			"llama.attention.layer_norm_rms": 1e-05,
+		},
+		"capabilities": []string{"completion"},
+	}
+
+	mux := http.NewServeMux()
+	reply := func(v any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { json.NewEncoder(w).Encode(v) }
+	}
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "Ollama is running") })
+	mux.HandleFunc("GET /api/version", reply(map[string]string{"version": "0.5.7"}))
+	mux.HandleFunc("GET /api/tags", reply(tags))
+	mux.HandleFunc("GET /api/ps", reply(ps))
+	mux.HandleFunc("POST /api/show", reply(show))
+	return mux
+}
+
+func TestOllamaRefreshAfterCall(t *testing.T) {
+	var polls atomic.Int32
+	inPoll, release := make(chan struct{}), make(chan struct{})
+	handler := fakeOllamaHandler(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/ps" && polls.Add(1) == 1 {
+			close(inPoll)
+			<-release
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	cfg := defaultConfig()
+	cfg.OllamaHost = srv.URL
+	m := NewOllamaMonitor(cfg)
+
+	done := make(chan struct{})
+	go func() {
+		m.Refresh(0)
+		done <- struct{}{}
+	}()
+	<-inPoll
+	// This call joins a poll that started before it, so it has to poll
+	// again.
+	go func() {
+		m.Refresh(0)
+		done <- struct{}{}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-done
+	<-done
+	if n := polls.Load(); n != 2 {
+		t.Errorf("got %d polls, want 2", n)
+	}
+
+	// A caller allowing an older result shares the last poll.
+	m.Refresh(time.Minute)
+	if n := polls.Load(); n != 2 {
+		t.Errorf("Refresh(time.Minute) polled again")
+	}
+}
+
+func TestNormalizeOllamaHost(t *testing.T) {
+	for _, tc := range []struct{ host, want string }{
+		{"", "http://localhost:11434"},
+		{"http://localhost:11434", "http://localhost:11434"},
+		{"http://localhost:11434/", "http://localhost:11434"},
+		{"http://localhost:11434//", "http://localhost:11434"},
+		{"https://ollama.example.com/", "https://ollama.example.com"},
+		{"localhost:11434", "http://localhost:11434"},
+		{"gpu-box:11434/", "http://gpu-box:11434"},
+		{"10.0.0.5:11434", "http://10.0.0.5:11434"},
+		{"httpd-host:11434", "http://httpd-host:11434"},
+		{"http://proxy.example.com/ollama/", "http://proxy.example.com/ollama"},
+		{"http://localhost:11434/?x=1#frag", "http://localhost:11434"},
+	} {
+		if got := normalizeOllamaHost(tc.host); got != tc.want {
+			t.Errorf("normalizeOllamaHost(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkOllamaFetch(b *testing.B) {
+	srv := newFakeOllama(4)
+	defer srv.Close()
+	cfg := defaultConfig()
+	cfg.OllamaHost = srv.URL
+	m := NewOllamaMonitor(cfg)
+	if stats, _ := m.fetch(); len(stats.RunningModels) != 4 {
+		b.Fatalf("got %d running models, want 4", len(stats.RunningModels))
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		m.fetch()
+	}
+}
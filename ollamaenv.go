@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Ollama doesn't expose its server configuration over the API, but when it
+// runs on this host its environment can be read from /proc (given the same
+// user or CAP_SYS_PTRACE).
+
+// isLocalHost reports whether an Ollama host URL points at this machine.
+func isLocalHost(host string) bool {
+	u, err := url.Parse(host)
+	if err != nil {
+		return false
+	}
+	switch name := u.Hostname(); name {
+	case "", "localhost", "0.0.0.0", "::":
+		return true
+	default:
+		ip := net.ParseIP(name)
+		return ip != nil && ip.IsLoopback()
+	}
+}
+
+// ollamaServerEnv returns the environment of the local `ollama serve`
+// process, or nil if none is visible or its environment is unreadable.
+func ollamaServerEnv() map[string]string {
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != "ollama" {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || !bytes.Contains(cmdline, []byte("serve")) {
+			continue
+		}
+		environ, err := os.ReadFile(filepath.Join(dir, "environ"))
+		if err != nil {
+			return nil
+		}
+		env := make(map[string]string)
+		for _, kv := range bytes.Split(environ, []byte{0}) {
+			if k, v, ok := strings.Cut(string(kv), "="); ok {
+				env[k] = v
+			}
+		}
+		return env
+	}
+	return nil
+}
+
+func envMapInt(env map[string]string, key string) int {
+	n, _ := strconv.Atoi(env[key])
+	return n
+}
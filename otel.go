@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// startOTLP pushes the Prometheus metric set to an OpenTelemetry collector
+// as gauges. It is enabled by OTEL_EXPORTER_OTLP_ENDPOINT (or the
+// metrics-specific variant); the exporter and reader read the other
+// standard OTEL_* variables themselves, e.g. OTEL_METRIC_EXPORT_INTERVAL.
+// The returned function flushes and stops the exporter.
+func startOTLP(gpuMon *GPUMonitor, ollamaMon *OllamaMonitor) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT") == "" {
+		return nil, nil
+	}
+	ctx := context.Background()
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("otlp resource: %w", err)
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	meter := provider.Meter("github.com/shostkevych/go-smi-api")
+
+	collect := func() []*metricFamily {
+		return append(collectGPUMetrics(gpuMon.Latest()), collectOllamaMetrics(ollamaMon.Latest())...)
+	}
+
+	// Instruments are created up front from the family names; the callback
+	// then observes whatever samples the current snapshots have.
+	gauges := make(map[string]metric.Float64ObservableGauge)
+	var observables []metric.Observable
+	for _, f := range collect() {
+		g, err := meter.Float64ObservableGauge(f.name, metric.WithDescription(f.help))
+		if err != nil {
+			return nil, fmt.Errorf("otlp gauge %s: %w", f.name, err)
+		}
+		gauges[f.name] = g
+		observables = append(observables, g)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, f := range collect() {
+			g, ok := gauges[f.name]
+			if !ok {
+				continue
+			}
+			for _, s := range f.samples {
+				attrs := make([]attribute.KeyValue, len(s.labels))
+				for i, l := range s.labels {
+					attrs[i] = attribute.String(l.name, l.value)
+				}
+				o.ObserveFloat64(g, s.value, metric.WithAttributes(attrs...))
+			}
+		}
+		return nil
+	}, observables...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp callback: %w", err)
+	}
+	return provider.Shutdown, nil
+}
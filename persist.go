@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dataDir is where persisted state lives, DATA_DIR or "data".
+func dataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "data"
+}
+
+// historyStore appends GPU snapshots to DATA_DIR/history.jsonl so the
+// history buffer survives restarts. When the file grows past maxBytes it is
+// rotated to history.jsonl.1, replacing the previous rotation.
+type historyStore struct {
+	path      string
+	maxBytes  int64
+	interval  time.Duration
+	f         *os.File
+	size      int64
+	lastWrite time.Time
+}
+
+func newHistoryStore(dir string, maxBytes int64, interval time.Duration) (*historyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &historyStore{
+		path:     filepath.Join(dir, "history.jsonl"),
+		maxBytes: maxBytes,
+		interval: interval,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *historyStore) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// load returns persisted samples taken at or after since, oldest first.
+func (s *historyStore) load(since time.Time) []historySample {
+	var out []historySample
+	for _, path := range []string{s.path + ".1", s.path} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			var sample historySample
+			if err := json.Unmarshal(sc.Bytes(), &sample); err != nil || sample.Metrics == nil {
+				continue
+			}
+			if !sample.Time.Before(since) {
+				out = append(out, sample)
+			}
+		}
+		f.Close()
+	}
+	return out
+}
+
+// maybeAppend writes the snapshot if at least interval has passed since
+// the last write.
+func (s *historyStore) maybeAppend(t time.Time, metrics *GPUMetrics) {
+	if t.Sub(s.lastWrite) < s.interval {
+		return
+	}
+	s.lastWrite = t
+	line, err := json.Marshal(historySample{Time: t, Metrics: metrics})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if s.size+int64(len(line)) > s.maxBytes {
+		// A failed rotation leaves the current file open (if it could be
+		// reopened), so keep appending to it.
+		if err := s.rotate(); err != nil {
+			log.Println("history rotate:", err)
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		log.Println("history write:", err)
+	}
+}
+
+// rotate moves the current file to path.1 and starts a new one. If the
+// rename fails, the current file is reopened so writes can go on.
+func (s *historyStore) rotate() error {
+	s.f.Close()
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		if openErr := s.open(); openErr != nil {
+			return fmt.Errorf("rename: %w; reopen: %v", err, openErr)
+		}
+		return fmt.Errorf("rename: %w", err)
+	}
+	return s.open()
+}
+
+func (s *historyStore) Close() error {
+	return s.f.Close()
+}
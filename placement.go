@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ollamaRunner is an Ollama process as seen across all GPUs.
+type ollamaRunner struct {
+	gpus   []int
+	memMiB int
+}
+
+// placeModels sets Placement on every running model that uses VRAM,
+// based on the GPU snapshot. It is a no-op without GPU data.
+func placeModels(stats *OllamaStats, gpus *GPUMetrics) {
+	if stats == nil || gpus == nil || len(gpus.GPUs) == 0 {
+		return
+	}
+	if len(gpus.GPUs) == 1 {
+		for i := range stats.RunningModels {
+			if stats.RunningModels[i].SizeVRAMBytes > 0 {
+				stats.RunningModels[i].Placement = &ModelPlacement{
+					GPUIndexes: []int{gpus.GPUs[0].Index},
+					Confidence: "high",
+					Method:     "single_gpu",
+				}
+			}
+		}
+		return
+	}
+
+	runners := make(map[int]*ollamaRunner)
+	for _, g := range gpus.GPUs {
+		for _, p := range g.Processes {
+			if !strings.HasPrefix(filepath.Base(p.ProcessName), "ollama") {
+				continue
+			}
+			r := runners[p.PID]
+			if r == nil {
+				r = &ollamaRunner{}
+				runners[p.PID] = r
+			}
+			r.gpus = append(r.gpus, g.Index)
+			r.memMiB += p.UsedMemoryMiB
+		}
+	}
+
+	// Pair models with runners greedily, closest memory match first.
+	type pair struct {
+		model int
+		pid   int
+		diff  float64
+	}
+	var pairs []pair
+	for i, rm := range stats.RunningModels {
+		if rm.SizeVRAMBytes <= 0 {
+			continue
+		}
+		modelMiB := float64(rm.SizeVRAMBytes) / (1 << 20)
+		for pid, r := range runners {
+			pairs = append(pairs, pair{i, pid, math.Abs(float64(r.memMiB)-modelMiB) / modelMiB})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].diff != pairs[j].diff {
+			return pairs[i].diff < pairs[j].diff
+		}
+		return pairs[i].pid < pairs[j].pid
+	})
+	placedModel := make(map[int]bool)
+	usedPID := make(map[int]bool)
+	for _, p := range pairs {
+		if placedModel[p.model] || usedPID[p.pid] {
+			continue
+		}
+		placedModel[p.model], usedPID[p.pid] = true, true
+		confidence := "low"
+		switch {
+		case p.diff <= 0.10:
+			confidence = "high"
+		case p.diff <= 0.25:
+			confidence = "medium"
+		}
+		stats.RunningModels[p.model].Placement = &ModelPlacement{
+			GPUIndexes: runners[p.pid].gpus,
+			Confidence: confidence,
+			Method:     "process_memory",
+		}
+	}
+}
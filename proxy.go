@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ollamaProxy forwards /ollama/* to the Ollama host and records latency
+// and token counts of every response, aggregated per model. Bodies are
+// streamed through unbuffered; only the last line of each response is
+// kept, since that's where Ollama puts the final stats of a (streamed or
+// not) generate, chat or embed call.
+type ollamaProxy struct {
+	proxy *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	requests int64
+	errors   int64 // requests Ollama couldn't be reached for
+	models   map[string]*proxyModelAcc
+}
+
+// ProxyStats is the response of /api/ollama/proxy: requests made through
+// the /ollama/ passthrough since startup.
+type ProxyStats struct {
+	Requests int64             `json:"requests"`
+	Errors   int64             `json:"errors"` // Ollama unreachable
+	Models   []ProxyModelStats `json:"models"`
+}
+
+type ProxyModelStats struct {
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"` // HTTP status 400 or above
+	// Latencies are measured at the proxy: time to the first body byte
+	// and to the end of the response.
+	AvgFirstByteMs float64 `json:"avg_first_byte_ms"`
+	AvgLatencyMs   float64 `json:"avg_latency_ms"`
+	MaxLatencyMs   float64 `json:"max_latency_ms"`
+	// Token counts and rates come from Ollama's own final stats.
+	PromptTokens       int64   `json:"prompt_tokens"`
+	EvalTokens         int64   `json:"eval_tokens"`
+	PromptTokensPerSec float64 `json:"prompt_tokens_per_sec"`
+	EvalTokensPerSec   float64 `json:"eval_tokens_per_sec"`
+	LastRequestAt      string  `json:"last_request_at"`
+}
+
+type proxyModelAcc struct {
+	requests, errors          int64
+	firstByte, total, maxTime time.Duration
+	promptTokens, evalTokens  int64
+	promptDur, evalDur        time.Duration
+	last                      time.Time
+}
+
+// ollamaFinalStats is the part of Ollama's last response line we use.
+// Durations are in nanoseconds.
+type ollamaFinalStats struct {
+	Model              string `json:"model"`
+	PromptEvalCount    int64  `json:"prompt_eval_count"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration"`
+	EvalCount          int64  `json:"eval_count"`
+	EvalDuration       int64  `json:"eval_duration"`
+}
+
+// maxTrackedLine bounds how much of a response line is kept to look for
+// the final stats; longer lines (huge non-streamed outputs) go unrecorded.
+const maxTrackedLine = 1 << 20
+
+type proxyStartKey struct{}
+
+func newOllamaProxy(host string, transport http.RoundTripper) (*ollamaProxy, error) {
+	target, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	p := &ollamaProxy{models: make(map[string]*proxyModelAcc)}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// Strip our prefix first; SetURL then joins the path onto
+			// any path of OLLAMA_HOST.
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, "/ollama")
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.Out.Host = target.Host
+		},
+		Transport:     transport,
+		FlushInterval: -1, // stream tokens as they arrive
+		ModifyResponse: func(resp *http.Response) error {
+			start, _ := resp.Request.Context().Value(proxyStartKey{}).(time.Time)
+			resp.Body = &statsBody{ReadCloser: resp.Body, start: start, status: resp.StatusCode, done: p.record}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.mu.Lock()
+			p.requests++
+			p.errors++
+			p.mu.Unlock()
+			log.Println("ollama proxy:", err)
+			writeJSONError(w, http.StatusBadGateway, "ollama_unreachable", err.Error())
+		},
+	}
+	return p, nil
+}
+
+func (p *ollamaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), proxyStartKey{}, time.Now())
+	p.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// record accounts one finished response. final is its last line.
+func (p *ollamaProxy) record(b *statsBody, final []byte) {
+	now := time.Now()
+	var stats ollamaFinalStats
+	json.Unmarshal(final, &stats)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	if stats.Model == "" {
+		if b.status < 400 {
+			return // not a model call, e.g. /api/tags
+		}
+		// Error responses don't name the model.
+		stats.Model = "unknown"
+	}
+	acc := p.models[stats.Model]
+	if acc == nil {
+		acc = &proxyModelAcc{}
+		p.models[stats.Model] = acc
+	}
+	acc.requests++
+	if b.status >= 400 {
+		acc.errors++
+	}
+	total := now.Sub(b.start)
+	if !b.firstByte.IsZero() {
+		acc.firstByte += b.firstByte.Sub(b.start)
+	}
+	acc.total += total
+	acc.maxTime = max(acc.maxTime, total)
+	acc.promptTokens += stats.PromptEvalCount
+	acc.evalTokens += stats.EvalCount
+	acc.promptDur += time.Duration(stats.PromptEvalDuration)
+	acc.evalDur += time.Duration(stats.EvalDuration)
+	acc.last = now
+}
+
+func (p *ollamaProxy) Stats() *ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := &ProxyStats{Requests: p.requests, Errors: p.errors, Models: []ProxyModelStats{}}
+	for name, acc := range p.models {
+		n := float64(acc.requests)
+		out.Models = append(out.Models, ProxyModelStats{
+			Model:              name,
+			Requests:           acc.requests,
+			Errors:             acc.errors,
+			AvgFirstByteMs:     round2(float64(acc.firstByte.Milliseconds()) / n),
+			AvgLatencyMs:       round2(float64(acc.total.Milliseconds()) / n),
+			MaxLatencyMs:       float64(acc.maxTime.Milliseconds()),
+			PromptTokens:       acc.promptTokens,
+			EvalTokens:         acc.evalTokens,
+			PromptTokensPerSec: tokensPerSec(acc.promptTokens, acc.promptDur),
+			EvalTokensPerSec:   tokensPerSec(acc.evalTokens, acc.evalDur),
+			LastRequestAt:      acc.last.UTC().Format(time.RFC3339),
+		})
+	}
+	slices.SortFunc(out.Models, func(a, b ProxyModelStats) int { return strings.Compare(a.Model, b.Model) })
+	return out
+}
+
+func tokensPerSec(tokens int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return round2(float64(tokens) / d.Seconds())
+}
+
+// statsBody passes a response body through, noting when the first byte
+// arrived and keeping the last line.
+type statsBody struct {
+	io.ReadCloser
+	start     time.Time
+	status    int
+	firstByte time.Time
+	line      []byte // line being read
+	last      []byte // last complete line
+	overflow  bool   // current line exceeded maxTrackedLine
+	done      func(b *statsBody, final []byte)
+	once      sync.Once
+}
+
+func (b *statsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.firstByte.IsZero() {
+		b.firstByte = time.Now()
+	}
+	for chunk := p[:n]; len(chunk) > 0; {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			b.appendLine(chunk)
+			break
+		}
+		b.appendLine(chunk[:i])
+		if len(bytes.TrimSpace(b.line)) > 0 && !b.overflow {
+			b.last = append(b.last[:0], b.line...)
+		}
+		b.line, b.overflow = b.line[:0], false
+		chunk = chunk[i+1:]
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *statsBody) appendLine(s []byte) {
+	if b.overflow || len(b.line)+len(s) > maxTrackedLine {
+		b.overflow = true
+		return
+	}
+	b.line = append(b.line, s...)
+}
+
+func (b *statsBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *statsBody) finish() {
+	b.once.Do(func() {
+		final := b.last
+		if len(bytes.TrimSpace(b.line)) > 0 && !b.overflow {
+			final = b.line // no trailing newline
+		}
+		b.done(b, final)
+	})
+}
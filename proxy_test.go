@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOllamaProxyPath(t *testing.T) {
+	var got string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Path
+		io.WriteString(w, `{"model":"llama3:8b","eval_count":1}`)
+	}))
+	defer ollama.Close()
+
+	for _, tc := range []struct {
+		host, path, want string
+	}{
+		{ollama.URL, "/ollama/api/chat", "/api/chat"},
+		{ollama.URL + "/", "/ollama/api/chat", "/api/chat"},
+		// Ollama behind a reverse proxy under a path of its own.
+		{ollama.URL + "/llm", "/ollama/api/chat", "/llm/api/chat"},
+		{ollama.URL + "/llm/", "/ollama/api/tags", "/llm/api/tags"},
+	} {
+		p, err := newOllamaProxy(tc.host, http.DefaultTransport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest("POST", tc.path, nil))
+		if rec.Code != http.StatusOK || got != tc.want {
+			t.Errorf("OLLAMA_HOST=%s: %s went to %s (status %d), want %s", tc.host, tc.path, got, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// remapRefresh is how often row-remapping status is re-read once a GPU
+// supporting it has been found. Remaps only happen after memory errors,
+// so there's no point in querying every poll; hosts where no GPU
+// supports remapping (pre-Ampere) are only checked once.
+const remapRefresh = time.Minute
+
+// rowRemapInfo returns row-remapping status keyed by GPU UUID.
+func (b *smiBackend) rowRemapInfo() map[string]RowRemapInfo {
+	if !b.remapChecked.IsZero() && (len(b.remaps) == 0 || time.Since(b.remapChecked) < remapRefresh) {
+		return b.remaps
+	}
+	b.remapChecked = time.Now()
+	out, err := b.run(
+		"--query-remapped-rows=gpu_uuid,remapped_rows.correctable,remapped_rows.uncorrectable,remapped_rows.pending,remapped_rows.failure",
+		"--format=csv,noheader,nounits",
+	)
+	if err != nil {
+		log.Println("nvidia-smi --query-remapped-rows:", err)
+		return b.remaps
+	}
+	b.remaps = parseRemappedRows(string(out))
+	return b.remaps
+}
+
+// parseRemappedRows parses --query-remapped-rows CSV output. GPUs that
+// report N/A, i.e. don't support row remapping, are omitted.
+func parseRemappedRows(out string) map[string]RowRemapInfo {
+	remaps := make(map[string]RowRemapInfo)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ", ")
+		if len(fields) < 5 || isNA(fields[1]) {
+			continue
+		}
+		remaps[fields[0]] = RowRemapInfo{
+			Correctable:   parseInt(fields[1]),
+			Uncorrectable: parseInt(fields[2]),
+			PendingRemap:  remapFlag(fields[3]),
+			RemapFailure:  remapFlag(fields[4]),
+		}
+	}
+	return remaps
+}
+
+// remapFlag parses the pending and failure columns, which depending on
+// the driver read "Yes"/"No" or 1/0.
+func remapFlag(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "1", "true":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Output options are applied to data responses at serialization time, so
+// the structs keep a single canonical unit (MiB or bytes) internally.
+//
+// Conversion works on the JSON field names: any numeric field ending in
+// "_mib" or "_bytes" is converted and renamed with the requested unit's
+// suffix, e.g. memory_used_mib becomes memory_used_gb with ?units=gb.
+//
+// ?bigint=string encodes integer "_bytes" fields as JSON strings, since
+// JavaScript numbers lose precision above 2^53. It applies by field name
+// rather than magnitude so a field's type doesn't change with its value.
+//
+// ?temp=f and ?power=mw|kw add converted copies of "_c" and "_w" fields
+// next to the canonical ones, e.g. temperature_f after temperature_c.
+//
+// ?processes=false drops every "processes" list, which dominates the
+// payload on hosts with many GPU processes.
+//
+// Non-integer numbers are rounded to FLOAT_PRECISION decimals, or
+// ?precision=N, before any conversion; converted values keep their own
+// rounding.
+
+type outputOptions struct {
+	units     string // "", "bytes", "mib" or "gb"
+	bigint    string // "" or "string"
+	temp      string // "" or "f"
+	power     string // "", "mw" or "kw"
+	round     bool
+	precision int // decimals, if round
+
+	noProcesses bool
+}
+
+// floatPrecision is the default number of decimals floats are rounded to
+// in data responses; -1 leaves them as computed. Set from FLOAT_PRECISION.
+var floatPrecision = -1
+
+// maxPrecision bounds ?precision; float64 has no more meaningful digits
+// for the values served here.
+const maxPrecision = 10
+
+// powerScale is the number of the unit in one watt.
+var powerScale = map[string]float64{
+	"mw": 1000,
+	"kw": 0.001,
+}
+
+// unitScale is the number of bytes in one unit. "gb" is decimal (10^9).
+var unitScale = map[string]float64{
+	"bytes": 1,
+	"mib":   1 << 20,
+	"gb":    1e9,
+}
+
+func parseOutputOptions(r *http.Request) (outputOptions, error) {
+	var opts outputOptions
+	q := r.URL.Query()
+	if u := strings.ToLower(q.Get("units")); u != "" {
+		if _, ok := unitScale[u]; !ok {
+			return opts, fmt.Errorf("invalid units %q: want bytes, mib or gb", u)
+		}
+		opts.units = u
+	}
+	if t := strings.ToLower(q.Get("temp")); t != "" && t != "c" {
+		if t != "f" {
+			return opts, fmt.Errorf("invalid temp %q: want c or f", t)
+		}
+		opts.temp = t
+	}
+	if p := strings.ToLower(q.Get("power")); p != "" && p != "w" {
+		if _, ok := powerScale[p]; !ok {
+			return opts, fmt.Errorf("invalid power %q: want w, mw or kw", p)
+		}
+		opts.power = p
+	}
+	if p := strings.ToLower(q.Get("processes")); p != "" {
+		show, err := strconv.ParseBool(p)
+		if err != nil {
+			return opts, fmt.Errorf("invalid processes %q: want true or false", p)
+		}
+		opts.noProcesses = !show
+	}
+	if floatPrecision >= 0 {
+		opts.round, opts.precision = true, floatPrecision
+	}
+	if p := q.Get("precision"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < -1 || n > maxPrecision {
+			return opts, fmt.Errorf("invalid precision %q: want 0-%d, or -1 for full precision", p, maxPrecision)
+		}
+		opts.round, opts.precision = n >= 0, max(n, 0)
+	}
+	if b := strings.ToLower(q.Get("bigint")); b != "" {
+		if b != "string" {
+			return opts, fmt.Errorf("invalid bigint %q: want string", b)
+		}
+		opts.bigint = b
+	}
+	return opts, nil
+}
+
+func (o outputOptions) empty() bool {
+	return o == outputOptions{}
+}
+
+// writeData writes v like writeJSON, honoring the output options in the
+// request's query string.
+func writeData(w http.ResponseWriter, r *http.Request, v any) {
+	opts, err := parseOutputOptions(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_option", err.Error())
+		return
+	}
+	if opts.empty() {
+		writeJSON(w, v)
+		return
+	}
+	out, err := render(v, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "render", err.Error())
+		return
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// render marshals v and rewrites it according to opts.
+func render(v any, opts outputOptions) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeOrdered(json.NewDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, err
+	}
+	if opts.noProcesses {
+		tree = dropField(tree, "processes")
+	}
+	if opts.units != "" {
+		tree = convertUnits(tree, opts.units)
+		if obj, ok := tree.(jsonObject); ok {
+			tree = append(obj, jsonField{"units", opts.units})
+		}
+	}
+	if opts.temp != "" || opts.power != "" {
+		tree = addConvertedUnits(tree, opts)
+	}
+	// Round last, so converted values (e.g. MiB to GB) get the requested
+	// precision too.
+	if opts.round {
+		roundFloats(tree, opts.precision)
+	}
+	if opts.bigint == "string" {
+		stringifyBytes(tree)
+	}
+	var buf bytes.Buffer
+	encodeOrdered(&buf, tree)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func convertUnits(v any, unit string) any {
+	switch v := v.(type) {
+	case jsonObject:
+		// A struct may carry the same quantity in two units (e.g. max_size_bytes
+		// and max_size_mib); after renaming keep only the first.
+		out := make(jsonObject, 0, len(v))
+		seen := make(map[string]bool, len(v))
+		for _, f := range v {
+			f = convertField(f, unit)
+			if seen[f.key] {
+				continue
+			}
+			seen[f.key] = true
+			out = append(out, f)
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = convertUnits(v[i], unit)
+		}
+	}
+	return v
+}
+
+func convertField(f jsonField, unit string) jsonField {
+	n, ok := f.val.(json.Number)
+	if !ok {
+		f.val = convertUnits(f.val, unit)
+		return f
+	}
+	for from, scale := range unitScale {
+		base, found := strings.CutSuffix(f.key, "_"+from)
+		if !found || from == unit {
+			continue
+		}
+		x, err := n.Float64()
+		if err != nil {
+			return f
+		}
+		return jsonField{base + "_" + unit, formatUnit(x*scale/unitScale[unit], unit)}
+	}
+	return f
+}
+
+// addConvertedUnits inserts a Fahrenheit copy after every numeric "_c"
+// field and a copy in the requested power unit after every "_w" field.
+func addConvertedUnits(v any, opts outputOptions) any {
+	switch v := v.(type) {
+	case jsonObject:
+		out := make(jsonObject, 0, len(v))
+		for _, f := range v {
+			n, ok := f.val.(json.Number)
+			if !ok {
+				f.val = addConvertedUnits(f.val, opts)
+				out = append(out, f)
+				continue
+			}
+			out = append(out, f)
+			x, err := n.Float64()
+			if err != nil {
+				continue
+			}
+			if base, found := strings.CutSuffix(f.key, "_c"); found && opts.temp == "f" {
+				out = append(out, jsonField{base + "_f", formatFloat(math.Round((x*9/5+32)*10) / 10)})
+			}
+			if base, found := strings.CutSuffix(f.key, "_w"); found && opts.power != "" {
+				out = append(out, jsonField{base + "_" + opts.power, formatFloat(math.Round(x*powerScale[opts.power]*1000) / 1000)})
+			}
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = addConvertedUnits(v[i], opts)
+		}
+	}
+	return v
+}
+
+// dropField removes every field named key, at any depth.
+func dropField(v any, key string) any {
+	switch v := v.(type) {
+	case jsonObject:
+		out := v[:0]
+		for _, f := range v {
+			if f.key != key {
+				f.val = dropField(f.val, key)
+				out = append(out, f)
+			}
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = dropField(v[i], key)
+		}
+	}
+	return v
+}
+
+// roundFloats rounds every non-integer number to the given decimals, in
+// place. Integers are left alone so their JSON type doesn't change.
+func roundFloats(v any, decimals int) {
+	scale := math.Pow10(decimals)
+	switch v := v.(type) {
+	case jsonObject:
+		for i, f := range v {
+			if n, ok := f.val.(json.Number); ok {
+				v[i].val = roundNumber(n, scale)
+			} else {
+				roundFloats(f.val, decimals)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if n, ok := e.(json.Number); ok {
+				v[i] = roundNumber(n, scale)
+			} else {
+				roundFloats(e, decimals)
+			}
+		}
+	}
+}
+
+func roundNumber(n json.Number, scale float64) json.Number {
+	if !strings.ContainsAny(string(n), ".eE") {
+		return n
+	}
+	x, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	return formatFloat(math.Round(x*scale) / scale)
+}
+
+func formatFloat(x float64) json.Number {
+	return json.Number(strconv.FormatFloat(x, 'f', -1, 64))
+}
+
+// stringifyBytes replaces integer values of "_bytes" fields with their
+// decimal string, in place.
+func stringifyBytes(v any) {
+	switch v := v.(type) {
+	case jsonObject:
+		for i, f := range v {
+			n, ok := f.val.(json.Number)
+			if !ok {
+				stringifyBytes(f.val)
+				continue
+			}
+			if strings.HasSuffix(f.key, "_bytes") && !strings.ContainsAny(string(n), ".eE") {
+				v[i].val = string(n)
+			}
+		}
+	case []any:
+		for _, e := range v {
+			stringifyBytes(e)
+		}
+	}
+}
+
+func formatUnit(x float64, unit string) json.Number {
+	if unit == "bytes" {
+		return json.Number(strconv.FormatInt(int64(math.Round(x)), 10))
+	}
+	return json.Number(strconv.FormatFloat(x, 'f', -1, 64))
+}
+
+// Ordered JSON tree. encoding/json decodes objects into maps, which loses
+// the field order of the original structs; these types keep it.
+
+type jsonField struct {
+	key string
+	val any
+}
+
+type jsonObject []jsonField
+
+// decodeOrdered reads one JSON value. Objects become jsonObject, arrays
+// []any and numbers json.Number.
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{keyTok.(string), val})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return tok, nil
+}
+
+func encodeOrdered(w io.Writer, v any) {
+	switch v := v.(type) {
+	case jsonObject:
+		io.WriteString(w, "{")
+		for i, f := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			key, _ := json.Marshal(f.key)
+			w.Write(key)
+			io.WriteString(w, ":")
+			encodeOrdered(w, f.val)
+		}
+		io.WriteString(w, "}")
+	case []any:
+		io.WriteString(w, "[")
+		for i, e := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			encodeOrdered(w, e)
+		}
+		io.WriteString(w, "]")
+	case json.Number:
+		io.WriteString(w, string(v))
+	default:
+		b, _ := json.Marshal(v)
+		w.Write(b)
+	}
+}
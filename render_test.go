@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderRoundsConvertedUnits(t *testing.T) {
+	v := map[string]any{"memory_used_mib": 9000}
+	out, err := render(v, outputOptions{units: "gb", round: true, precision: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9000 MiB is 9.437184 GB.
+	if want := `"memory_used_gb":9.44`; !strings.Contains(string(out), want) {
+		t.Errorf("render = %s, want it to contain %s", out, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// safetyWatchdog runs SAFETY_CMD when a GPU stays above SAFETY_TEMP_C for
+// SAFETY_POLLS consecutive polls. It takes a real action on the host, so
+// it needs SAFETY_ENABLE=true on top of the limit and command, refuses
+// implausible limits, and runs at most once per SAFETY_COOLDOWN.
+type safetyWatchdog struct {
+	tempC    int
+	polls    int
+	cmd      string
+	cooldown time.Duration
+
+	over    map[string]int // consecutive polls over the limit, by UUID
+	lastRun time.Time
+}
+
+// Temperature limits outside this range are almost certainly typos.
+const (
+	minSafetyTempC = 60
+	maxSafetyTempC = 110
+)
+
+// newSafetyWatchdog returns nil unless the watchdog is fully configured.
+func newSafetyWatchdog() *safetyWatchdog {
+	if !envBool("SAFETY_ENABLE") {
+		return nil
+	}
+	s := &safetyWatchdog{
+		tempC:    envInt("SAFETY_TEMP_C", 0),
+		polls:    envInt("SAFETY_POLLS", 5),
+		cmd:      os.Getenv("SAFETY_CMD"),
+		cooldown: envDuration("SAFETY_COOLDOWN", 10*time.Minute),
+		over:     make(map[string]int),
+	}
+	switch {
+	case s.cmd == "":
+		log.Println("safety watchdog disabled: SAFETY_CMD is not set")
+		return nil
+	case s.tempC < minSafetyTempC || s.tempC > maxSafetyTempC:
+		log.Printf("safety watchdog disabled: SAFETY_TEMP_C=%d is outside %d-%d", s.tempC, minSafetyTempC, maxSafetyTempC)
+		return nil
+	case s.polls < 1:
+		s.polls = 1
+	}
+	log.Printf("safety watchdog armed: %q runs after %d polls above %dC", s.cmd, s.polls, s.tempC)
+	return s
+}
+
+// check updates the per-GPU counters from a snapshot and fires the command
+// for the first GPU that reaches the limit.
+func (s *safetyWatchdog) check(metrics *GPUMetrics) {
+	for _, g := range metrics.GPUs {
+		if g.TemperatureC <= s.tempC {
+			delete(s.over, g.UUID)
+			continue
+		}
+		s.over[g.UUID]++
+		n := s.over[g.UUID]
+		if n <= s.polls {
+			log.Printf("safety: GPU %d (%s) at %dC, above %dC for %d/%d polls", g.Index, g.UUID, g.TemperatureC, s.tempC, n, s.polls)
+		}
+		if n < s.polls {
+			continue
+		}
+		if since := time.Since(s.lastRun); since < s.cooldown {
+			if n == s.polls {
+				log.Printf("safety: not running %q, last run %s ago (cooldown %s)", s.cmd, since.Round(time.Second), s.cooldown)
+			}
+			continue
+		}
+		s.lastRun = time.Now()
+		go s.run(g)
+	}
+}
+
+// run executes the command through the shell with the offending GPU in
+// its environment, logging the outcome.
+func (s *safetyWatchdog) run(g GPUInfo) {
+	log.Printf("safety: running %q for GPU %d (%s) at %dC", s.cmd, g.Index, g.UUID, g.TemperatureC)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.cmd)
+	cmd.Env = append(os.Environ(),
+		"SAFETY_GPU_INDEX="+strconv.Itoa(g.Index),
+		"SAFETY_GPU_UUID="+g.UUID,
+		fmt.Sprintf("SAFETY_GPU_TEMP_C=%d", g.TemperatureC),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("safety: %q failed: %v: %s", s.cmd, err, firstLine(string(out)))
+		return
+	}
+	log.Printf("safety: %q finished: %s", s.cmd, firstLine(string(out)))
+}
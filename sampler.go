@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// burstSampler streams GPU utilization from nvidia-smi at a sub-second
+// rate (--query-gpu with -lms) and keeps the peak per GPU between polls,
+// so short bursty kernels that a 1s sample misses still show up.
+type burstSampler struct {
+	gpuIDs string
+	period time.Duration
+
+	mu    sync.Mutex
+	peaks map[string]int // by UUID, since the last take
+}
+
+// samplerRestartDelay is how long to wait before restarting nvidia-smi
+// after the stream ends.
+const samplerRestartDelay = 5 * time.Second
+
+func newBurstSampler(gpuIDs string, period time.Duration) *burstSampler {
+	return &burstSampler{gpuIDs: gpuIDs, period: period, peaks: make(map[string]int)}
+}
+
+// run keeps the nvidia-smi stream going until stop is closed.
+func (s *burstSampler) run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		if err := s.stream(ctx); err != nil && ctx.Err() == nil {
+			log.Println("nvidia-smi sampler:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(samplerRestartDelay):
+		}
+	}
+}
+
+func (s *burstSampler) stream(ctx context.Context) error {
+	args := []string{
+		"--query-gpu=uuid,utilization.gpu",
+		"--format=csv,noheader,nounits",
+		"-lms", strconv.Itoa(int(s.period.Milliseconds())),
+	}
+	if s.gpuIDs != "" {
+		args = append([]string{"--id=" + s.gpuIDs}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "nvidia-smi", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C", "LANG=C")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		uuid, util, ok := strings.Cut(sc.Text(), ", ")
+		if !ok {
+			continue
+		}
+		pct, err := parseIntErr(util)
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		if pct > s.peaks[uuid] {
+			s.peaks[uuid] = pct
+		}
+		s.mu.Unlock()
+	}
+	return cmd.Wait()
+}
+
+// take returns the peaks since the previous call and starts a new window.
+func (s *burstSampler) take() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peaks := s.peaks
+	s.peaks = make(map[string]int, len(peaks))
+	return peaks
+}
+
+// applyPeaks sets GPUUtilizationPeakPct from the sampler's window, or to
+// the polled utilization itself when sampling is off. The polled value is
+// also a sample, so the peak is never below it.
+func (m *GPUMonitor) applyPeaks(metrics *GPUMetrics) {
+	var peaks map[string]int
+	if m.sampler != nil {
+		peaks = m.sampler.take()
+	}
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		g.GPUUtilizationPeakPct = max(peaks[g.UUID], g.GPUUtilizationPct)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sizeWindow is how many recent responses per route the size average and
+// p95 are computed over.
+const sizeWindow = 1000
+
+// SelfStats is the response of /api/self: metrics about this service
+// rather than the GPUs.
+type SelfStats struct {
+	Responses map[string]ResponseSizes `json:"responses"` // by route
+	Resources ResourceUsage            `json:"resources"`
+}
+
+// ResourceUsage is this process's file descriptor use. OpenFDs is -1 where
+// /proc/self/fd isn't available, and the limits are 0 where RLIMIT_NOFILE
+// isn't.
+type ResourceUsage struct {
+	OpenFDs       int    `json:"open_fds"`
+	FDSoftLimit   uint64 `json:"fd_soft_limit"`
+	FDHardLimit   uint64 `json:"fd_hard_limit"`
+	WSConnections int64  `json:"ws_connections"` // open /ws streams
+}
+
+type ResponseSizes struct {
+	Count    int64   `json:"count"` // since startup
+	AvgBytes float64 `json:"avg_bytes"`
+	P95Bytes int     `json:"p95_bytes"`
+}
+
+// responseSizes records the body size of responses per route, keeping the
+// last sizeWindow sizes of each.
+type responseSizes struct {
+	mu     sync.Mutex
+	routes map[string]*sizeRing
+}
+
+type sizeRing struct {
+	count int64
+	sizes []int
+	next  int
+}
+
+func newResponseSizes() *responseSizes {
+	return &responseSizes{routes: make(map[string]*sizeRing)}
+}
+
+// track wraps h to record the size of every response under route. Sizes
+// are of the uncompressed body as written by the handler.
+func (s *responseSizes) track(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		s.record(route, rec.size)
+	})
+}
+
+func (s *responseSizes) record(route string, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring := s.routes[route]
+	if ring == nil {
+		ring = &sizeRing{}
+		s.routes[route] = ring
+	}
+	ring.count++
+	if len(ring.sizes) < sizeWindow {
+		ring.sizes = append(ring.sizes, size)
+		return
+	}
+	ring.sizes[ring.next] = size
+	ring.next = (ring.next + 1) % sizeWindow
+}
+
+func (s *responseSizes) snapshot() map[string]ResponseSizes {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]ResponseSizes, len(s.routes))
+	for route, ring := range s.routes {
+		sorted := slices.Clone(ring.sizes)
+		slices.Sort(sorted)
+		total := 0
+		for _, n := range sorted {
+			total += n
+		}
+		out[route] = ResponseSizes{
+			Count:    ring.count,
+			AvgBytes: round2(float64(total) / float64(len(sorted))),
+			P95Bytes: sorted[(len(sorted)*95+99)/100-1],
+		}
+	}
+	return out
+}
+
+func collectSelfMetrics(s *responseSizes) []*metricFamily {
+	count := &metricFamily{name: "api_responses", help: "Responses served since startup."}
+	avg := &metricFamily{name: "api_response_size_avg_bytes", help: "Average response body size over recent responses."}
+	p95 := &metricFamily{name: "api_response_size_p95_bytes", help: "95th percentile response body size over recent responses."}
+	snap := s.snapshot()
+	for _, route := range slices.Sorted(maps.Keys(snap)) {
+		r, l := snap[route], label{"route", route}
+		count.add(float64(r.Count), l)
+		avg.add(r.AvgBytes, l)
+		p95.add(float64(r.P95Bytes), l)
+	}
+	return []*metricFamily{count, avg, p95}
+}
+
+// fdWarnFraction is the share of the soft RLIMIT_NOFILE open descriptors
+// may reach before watchFDs logs a warning.
+const fdWarnFraction = 0.8
+
+func resourceUsage() ResourceUsage {
+	u := ResourceUsage{OpenFDs: -1, WSConnections: wsConnections.Load()}
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		u.OpenFDs = len(entries) - 1 // minus the one reading the directory
+	}
+	u.FDSoftLimit, u.FDHardLimit, _ = fdLimits()
+	return u
+}
+
+// watchFDs checks the descriptor count every interval and logs, at most
+// once per parseReportInterval, when it nears the soft limit, so leaked
+// connections show up before accept starts failing.
+func watchFDs(interval time.Duration) {
+	var lastWarning time.Time
+	for range time.Tick(interval) {
+		u := resourceUsage()
+		if u.OpenFDs < 0 || u.FDSoftLimit == 0 || float64(u.OpenFDs) < fdWarnFraction*float64(u.FDSoftLimit) {
+			continue
+		}
+		if time.Since(lastWarning) < parseReportInterval {
+			continue
+		}
+		log.Printf("%d of %d file descriptors open (%d WebSocket connections); raise the limit (ulimit -n) or look for leaked connections", u.OpenFDs, u.FDSoftLimit, u.WSConnections)
+		lastWarning = time.Now()
+	}
+}
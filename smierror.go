@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Reasons reported by SMIError.
+const (
+	reasonNotInstalled    = "nvidia_smi_not_found"
+	reasonDriverNotLoaded = "driver_not_loaded"
+	reasonDriverMismatch  = "driver_library_mismatch"
+	reasonNoDevices       = "no_devices"
+	reasonUnknown         = "unknown"
+)
+
+// SMIError is an nvidia-smi failure classified by a machine-readable
+// Reason, so alerting can tell "driver crashed" from "tool missing".
+type SMIError struct {
+	Reason  string
+	Message string
+	Err     error
+}
+
+func (e *SMIError) Error() string {
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Message
+}
+
+func (e *SMIError) Unwrap() error {
+	return e.Err
+}
+
+// smiFailureSignatures maps substrings of nvidia-smi's error output to a
+// reason. nvidia-smi prints these on stdout, not stderr.
+var smiFailureSignatures = []struct {
+	match  string
+	reason string
+}{
+	{"Driver/library version mismatch", reasonDriverMismatch},
+	{"couldn't communicate with the NVIDIA driver", reasonDriverNotLoaded},
+	{"NVIDIA driver is not loaded", reasonDriverNotLoaded},
+	{"No devices were found", reasonNoDevices},
+}
+
+// classifySMIError wraps an error returned by running nvidia-smi, using its
+// captured output to determine the reason.
+func classifySMIError(err error, stdout []byte) *SMIError {
+	if errors.Is(err, exec.ErrNotFound) {
+		return &SMIError{Reason: reasonNotInstalled, Err: err}
+	}
+
+	output := string(stdout)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		output += "\n" + string(exitErr.Stderr)
+	}
+	smiErr := &SMIError{
+		Reason:  reasonUnknown,
+		Message: firstLine(output),
+		Err:     err,
+	}
+	for _, sig := range smiFailureSignatures {
+		if strings.Contains(output, sig.match) {
+			smiErr.Reason = sig.reason
+			break
+		}
+	}
+	return smiErr
+}
+
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
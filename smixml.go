@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// The "xml" strategy (SMI_STRATEGY=xml) gets GPU stats and processes from
+// one `nvidia-smi -q -x` call instead of the two CSV queries, halving the
+// forks per poll at the cost of a larger parse. The XML has no compute
+// capability, so that is read once per GPU with a CSV query, and
+// EXTRA_GPU_FIELDS aren't supported. GPU indexes are the order of the
+// GPUs in the output, which is why GPU_IDS forces the CSV strategy.
+
+type smiXMLLog struct {
+	DriverVersion string      `xml:"driver_version"`
+	GPUs          []smiXMLGPU `xml:"gpu"`
+}
+
+type smiXMLGPU struct {
+	BusID       string `xml:"id,attr"` // e.g. "00000000:3B:00.0"
+	ProductName string `xml:"product_name"`
+	UUID        string `xml:"uuid"`
+	FanSpeed    string `xml:"fan_speed"`
+	PState      string `xml:"performance_state"`
+	Persistence string `xml:"persistence_mode"`
+	PCIe        struct {
+		Current string `xml:"pci_gpu_link_info>pcie_gen>current_link_gen"`
+		Max     string `xml:"pci_gpu_link_info>pcie_gen>max_link_gen"`
+	} `xml:"pci"`
+	Memory struct {
+		Total string `xml:"total"`
+		Used  string `xml:"used"`
+		Free  string `xml:"free"`
+	} `xml:"fb_memory_usage"`
+	Utilization struct {
+		GPU    string `xml:"gpu_util"`
+		Memory string `xml:"memory_util"`
+	} `xml:"utilization"`
+	Temperature string `xml:"temperature>gpu_temp"`
+	// Power moved from power_readings to gpu_power_readings, and
+	// power_draw was split into instant and average draw, across driver
+	// releases.
+	Power    smiXMLPower `xml:"power_readings"`
+	GPUPower smiXMLPower `xml:"gpu_power_readings"`
+	Procs    []struct {
+		PID        string `xml:"pid"`
+		Name       string `xml:"process_name"`
+		UsedMemory string `xml:"used_memory"`
+	} `xml:"processes>process_info"`
+}
+
+type smiXMLPower struct {
+	Draw          string `xml:"power_draw"`
+	InstantDraw   string `xml:"instant_power_draw"`
+	AverageDraw   string `xml:"average_power_draw"`
+	Limit         string `xml:"power_limit"`
+	CurrentLimit  string `xml:"current_power_limit"`
+	EnforcedLimit string `xml:"enforced_power_limit"`
+}
+
+// queryXML runs nvidia-smi -q -x and returns the GPUs and their processes.
+func (b *smiBackend) queryXML() ([]GPUInfo, []procWithUUID, error) {
+	args := []string{"-q", "-x"}
+	out, err := b.run(args...)
+	b.recordRaw(&b.rawGPUs, args, out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("nvidia-smi -q -x: %w", err)
+	}
+	gpus, procs, err := parseSMIXML(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	caps := b.computeCaps(gpus)
+	for i := range gpus {
+		gpus[i].ComputeCapability = caps[gpus[i].UUID]
+		gpus[i].Architecture = architectureName(gpus[i].ComputeCapability)
+	}
+	return gpus, procs, nil
+}
+
+func parseSMIXML(out []byte) ([]GPUInfo, []procWithUUID, error) {
+	var doc smiXMLLog
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		return nil, nil, fmt.Errorf("nvidia-smi -q -x: %w", err)
+	}
+	var gpus []GPUInfo
+	var procs []procWithUUID
+	for i, x := range doc.GPUs {
+		powerDraw := firstSet(x.GPUPower.Draw, x.GPUPower.AverageDraw, x.GPUPower.InstantDraw, x.Power.Draw)
+		powerLimit := firstSet(x.GPUPower.CurrentLimit, x.GPUPower.EnforcedLimit, x.Power.EnforcedLimit, x.Power.Limit)
+		gpus = append(gpus, GPUInfo{
+			Index:             i,
+			Name:              x.ProductName,
+			UUID:              x.UUID,
+			PCIBusID:          x.BusID,
+			DriverVersion:     doc.DriverVersion,
+			TemperatureC:      parseInt(xmlValue(x.Temperature)),
+			FanSpeedPct:       parseInt(xmlValue(x.FanSpeed)),
+			HasFan:            !isNA(xmlValue(x.FanSpeed)),
+			PowerDrawW:        parseFloat(xmlValue(powerDraw)),
+			PowerLimitW:       parseFloat(xmlValue(powerLimit)),
+			MemoryUsedMiB:     parseInt(xmlValue(x.Memory.Used)),
+			MemoryTotalMiB:    parseInt(xmlValue(x.Memory.Total)),
+			MemoryFreeMiB:     parseInt(xmlValue(x.Memory.Free)),
+			GPUUtilizationPct: parseInt(xmlValue(x.Utilization.GPU)),
+			MemUtilizationPct: parseInt(xmlValue(x.Utilization.Memory)),
+			PState:            x.PState,
+			PersistenceMode:   persistenceMode(x.Persistence),
+			PCIEGenCurrent:    parseInt(xmlValue(x.PCIe.Current)),
+			PCIEGenMax:        parseInt(xmlValue(x.PCIe.Max)),
+
+			TemperatureAvailable:    available(x.Temperature),
+			PowerDrawAvailable:      available(powerDraw),
+			PowerLimitAvailable:     available(powerLimit),
+			GPUUtilizationAvailable: available(x.Utilization.GPU),
+			MemUtilizationAvailable: available(x.Utilization.Memory),
+		})
+		for _, p := range x.Procs {
+			procs = append(procs, procWithUUID{
+				uuid: x.UUID,
+				proc: GPUProcess{
+					PID:           parseInt(p.PID),
+					ProcessName:   p.Name,
+					UsedMemoryMiB: parseInt(xmlValue(p.UsedMemory)),
+				},
+			})
+		}
+	}
+	return gpus, procs, nil
+}
+
+// xmlValue strips the unit nvidia-smi appends to XML values ("250.00 W",
+// "30 %"), leaving N/A markers alone.
+func xmlValue(s string) string {
+	s = strings.TrimSpace(s)
+	if isNA(s) {
+		return s
+	}
+	v, _, _ := strings.Cut(s, " ")
+	return v
+}
+
+// firstSet returns the first value that is present and not N/A.
+func firstSet(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); !isNA(v) {
+			return v
+		}
+	}
+	return ""
+}
+
+// computeCaps returns the compute capability of each GPU by UUID. It is
+// static, so it's queried only when a new GPU shows up, and not again once
+// the driver turns out not to support the field.
+func (b *smiBackend) computeCaps(gpus []GPUInfo) map[string]string {
+	if b.xmlCaps == nil {
+		b.xmlCaps = make(map[string]string)
+	}
+	known := func(g GPUInfo) bool { _, ok := b.xmlCaps[g.UUID]; return ok }
+	if b.xmlCapsUnsupported || !slices.ContainsFunc(gpus, func(g GPUInfo) bool { return !known(g) }) {
+		return b.xmlCaps
+	}
+	out, err := b.run("--query-gpu=uuid,compute_cap", "--format=csv,noheader,nounits")
+	if err != nil {
+		log.Println("nvidia-smi compute_cap:", err)
+		b.xmlCapsUnsupported = true
+		return b.xmlCaps
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if uuid, cc, ok := strings.Cut(strings.TrimSpace(line), ", "); ok {
+			b.xmlCaps[uuid] = cc
+		}
+	}
+	// Don't query again for GPUs the output didn't cover.
+	for _, g := range gpus {
+		if !known(g) {
+			b.xmlCaps[g.UUID] = ""
+		}
+	}
+	return b.xmlCaps
+}
@@ -0,0 +1,38 @@
+package main
+
+import "math"
+
+// emaState is the running exponential moving average for one GPU.
+type emaState struct {
+	util, power, temp float64
+}
+
+// applySmoothing updates the per-UUID moving averages with metrics and
+// stores them in the *Smoothed fields. The first sample of a GPU seeds its
+// average, so smoothed values start at the raw ones.
+func (m *GPUMonitor) applySmoothing(metrics *GPUMetrics) {
+	if m.ema == nil {
+		m.ema = make(map[string]emaState)
+	}
+	a := m.smoothingAlpha
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		cur := emaState{float64(g.GPUUtilizationPct), g.PowerDrawW, float64(g.TemperatureC)}
+		s, ok := m.ema[g.UUID]
+		if !ok {
+			s = cur
+		} else {
+			s.util += a * (cur.util - s.util)
+			s.power += a * (cur.power - s.power)
+			s.temp += a * (cur.temp - s.temp)
+		}
+		m.ema[g.UUID] = s
+		g.GPUUtilizationPctSmoothed = round2(s.util)
+		g.PowerDrawWSmoothed = round2(s.power)
+		g.TemperatureCSmoothed = round2(s.temp)
+	}
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// gpuSpecsJSON holds published dense tensor-core peaks by GPU name as
+// nvidia-smi reports it. Add a line to cover another model.
+//
+//go:embed gpuspecs.json
+var gpuSpecsJSON []byte
+
+// gpuSpecs is gpuSpecsJSON keyed by lower-cased name.
+var gpuSpecs = func() map[string]*GPUSpecs {
+	var byName map[string]*GPUSpecs
+	if err := json.Unmarshal(gpuSpecsJSON, &byName); err != nil {
+		panic("gpuspecs.json: " + err.Error())
+	}
+	specs := make(map[string]*GPUSpecs, len(byName))
+	for name, s := range byName {
+		specs[strings.ToLower(name)] = s
+	}
+	return specs
+}()
+
+// specsFor returns the specs of a GPU model, or nil if it isn't in the
+// table. The result is shared and must not be modified.
+func specsFor(name string) *GPUSpecs {
+	return gpuSpecs[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// totalSpecs adds up the specs of the GPUs that have them; nil if none
+// do.
+func totalSpecs(gpus []GPUInfo) *GPUSpecs {
+	var total *GPUSpecs
+	for _, g := range gpus {
+		if g.Specs == nil {
+			continue
+		}
+		if total == nil {
+			total = &GPUSpecs{}
+		}
+		total.FP16TFLOPS += g.Specs.FP16TFLOPS
+		total.BF16TFLOPS += g.Specs.BF16TFLOPS
+		total.INT8TOPS += g.Specs.INT8TOPS
+	}
+	if total != nil {
+		// Keep sums like 165.2+165.2 from printing float noise.
+		total.FP16TFLOPS = math.Round(total.FP16TFLOPS*10) / 10
+		total.BF16TFLOPS = math.Round(total.BF16TFLOPS*10) / 10
+		total.INT8TOPS = math.Round(total.INT8TOPS*10) / 10
+	}
+	return total
+}
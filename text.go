@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// writeGPUText renders a compact nvidia-smi style table for terminals,
+// e.g. `watch curl -s host:8080/api/gpus?format=text`.
+func writeGPUText(w io.Writer, metrics *GPUMetrics) {
+	fmt.Fprintln(w, metrics.Timestamp)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GPU\tNAME\tTEMP\tUTIL\tMEMORY\tPOWER\tPROCS")
+	for _, g := range metrics.GPUs {
+		fmt.Fprintf(tw, "%d\t%s\t%dC\t%d%%\t%d / %d MiB\t%.0f / %.0f W\t%d\n",
+			g.Index, g.Name, g.TemperatureC, g.GPUUtilizationPct,
+			g.MemoryUsedMiB, g.MemoryTotalMiB, g.PowerDrawW, g.PowerLimitW,
+			len(g.Processes))
+	}
+	tw.Flush()
+}
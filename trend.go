@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// applyMemoryTrend fits a least-squares line to each GPU's memory use
+// over the trend window, including this snapshot, and records the slope
+// on metrics. A GPU is flagged as growing only when the slope exceeds the
+// threshold and the history covers at least half the window, so a single
+// model load right after startup doesn't look like a leak.
+func (m *GPUMonitor) applyMemoryTrend(now time.Time, metrics *GPUMetrics) {
+	samples := append(m.history.since(now.Add(-m.trendWindow)), historySample{Time: now, Metrics: metrics})
+
+	type fit struct {
+		n, sx, sy, sxx, sxy float64
+		first               time.Time
+	}
+	fits := make(map[string]*fit)
+	for _, s := range samples {
+		x := s.Time.Sub(now).Minutes()
+		for _, g := range s.Metrics.GPUs {
+			f := fits[g.UUID]
+			if f == nil {
+				f = &fit{first: s.Time}
+				fits[g.UUID] = f
+			}
+			y := float64(g.MemoryUsedMiB)
+			f.n++
+			f.sx += x
+			f.sy += y
+			f.sxx += x * x
+			f.sxy += x * y
+		}
+	}
+
+	for i := range metrics.GPUs {
+		g := &metrics.GPUs[i]
+		f := fits[g.UUID]
+		if f == nil || f.n < 2 {
+			continue
+		}
+		den := f.n*f.sxx - f.sx*f.sx
+		if den == 0 {
+			continue
+		}
+		slope := (f.n*f.sxy - f.sx*f.sy) / den
+		trend := math.Round(slope*100) / 100
+		if trend == 0 {
+			trend = 0 // normalize -0, which encodes as "-0"
+		}
+		g.MemoryTrendMiBPerMin = trend
+		g.MemoryGrowing = slope > m.trendThreshold && now.Sub(f.first) >= m.trendWindow/2
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "github.com/shostkevych/go-smi-api/api"
+
+// The response types are defined in package api so the client package can
+// share them.
+type (
+	GPUMetrics   = api.GPUMetrics
+	GPUInfo      = api.GPUInfo
+	GPUProcess   = api.GPUProcess
+	MissingGPU   = api.MissingGPU
+	NVLinkInfo   = api.NVLinkInfo
+	VGPUInfo     = api.VGPUInfo
+	RowRemapInfo = api.RowRemapInfo
+	GPUSpecs     = api.GPUSpecs
+
+	OllamaStats    = api.OllamaStats
+	RunningModel   = api.RunningModel
+	KVCacheInfo    = api.KVCacheInfo
+	VRAMBreakdown  = api.VRAMBreakdown
+	ModelPlacement = api.ModelPlacement
+	ModelCatalog   = api.ModelCatalog
+	AvailableModel = api.AvailableModel
+
+	wsPayload = api.Snapshot
+)
+
+const schemaVersion = api.SchemaVersion
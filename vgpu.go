@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// vgpuRefresh is how often vGPU details are re-read once a vGPU has been
+// detected, so license changes show up.
+const vgpuRefresh = time.Minute
+
+// vgpuInfo returns vGPU details keyed by GPU UUID. nvidia-smi -q is too
+// slow to run every poll, so it is run once to detect vGPU mode and then
+// only re-run periodically if a vGPU was found.
+func (b *smiBackend) vgpuInfo() map[string]VGPUInfo {
+	if !b.vgpuChecked.IsZero() && (len(b.vgpus) == 0 || time.Since(b.vgpuChecked) < vgpuRefresh) {
+		return b.vgpus
+	}
+	b.vgpuChecked = time.Now()
+	out, err := b.run("-q")
+	if err != nil {
+		log.Println("nvidia-smi -q:", err)
+		return b.vgpus
+	}
+	b.vgpus = parseVGPUQuery(string(out))
+	return b.vgpus
+}
+
+// parseVGPUQuery extracts vGPU guest details from nvidia-smi -q output.
+// GPUs that are not in VGPU virtualization mode are omitted.
+func parseVGPUQuery(out string) map[string]VGPUInfo {
+	type gpuState struct {
+		uuid, mode string
+		info       VGPUInfo
+	}
+	var gpus []*gpuState
+	var cur *gpuState
+	section := ""
+
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 {
+			if strings.HasPrefix(trimmed, "GPU ") {
+				cur = &gpuState{}
+				gpus = append(gpus, cur)
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			if indent <= 4 {
+				section = trimmed
+			}
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if indent <= 4 {
+			section = ""
+		}
+
+		switch {
+		case section == "" && key == "GPU UUID":
+			cur.uuid = value
+		case section == "" && key == "Product Name":
+			cur.info.Type = value
+		case section == "GPU Virtualization Mode" && key == "Virtualization Mode":
+			cur.mode = value
+		case section == "vGPU Software Licensed Product" && key == "Product Name":
+			cur.info.LicensedProduct = value
+		case section == "vGPU Software Licensed Product" && key == "License Status":
+			cur.info.LicenseStatus = value
+			cur.info.Licensed = strings.HasPrefix(value, "Licensed")
+		case section == "FB Memory Usage" && key == "Total":
+			n, err := parseIntErr(strings.TrimSuffix(value, " MiB"))
+			if err == nil {
+				cur.info.FramebufferMiB = n
+			}
+		}
+	}
+
+	vgpus := make(map[string]VGPUInfo)
+	for _, g := range gpus {
+		if g.uuid != "" && strings.EqualFold(g.mode, "VGPU") {
+			vgpus[g.uuid] = g.info
+		}
+	}
+	return vgpus
+}
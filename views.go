@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Views derived from the latest GPU snapshot.
+
+const defaultTopLimit = 5
+
+// topGPUKeys are the allowed ?by= values for /api/gpus/top.
+var topGPUKeys = map[string]func(GPUInfo) float64{
+	"utilization": func(g GPUInfo) float64 { return float64(g.GPUUtilizationPct) },
+	"memory":      func(g GPUInfo) float64 { return float64(g.MemoryUsedMiB) },
+	"power":       func(g GPUInfo) float64 { return g.PowerDrawW },
+	"temperature": func(g GPUInfo) float64 { return float64(g.TemperatureC) },
+	"efficiency":  func(g GPUInfo) float64 { return g.UtilPerWatt },
+}
+
+type TopGPUs struct {
+	Timestamp string    `json:"timestamp"`
+	By        string    `json:"by"`
+	GPUs      []GPUInfo `json:"gpus"`
+}
+
+// topGPUs returns up to limit GPUs from metrics, busiest first by the given
+// key. by and limit come straight from the query string.
+func topGPUs(metrics *GPUMetrics, by, limitParam string) (*TopGPUs, error) {
+	if by == "" {
+		by = "utilization"
+	}
+	key, ok := topGPUKeys[by]
+	if !ok {
+		return nil, fmt.Errorf("invalid by %q: want utilization, memory, power, temperature or efficiency", by)
+	}
+	limit := defaultTopLimit
+	if limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit %q: want a positive integer", limitParam)
+		}
+		limit = n
+	}
+
+	gpus := slices.Clone(metrics.GPUs)
+	slices.SortStableFunc(gpus, func(a, b GPUInfo) int {
+		ka, kb := key(a), key(b)
+		switch {
+		case ka > kb:
+			return -1
+		case ka < kb:
+			return 1
+		}
+		return 0
+	})
+	if len(gpus) > limit {
+		gpus = gpus[:limit]
+	}
+	return &TopGPUs{Timestamp: metrics.Timestamp, By: by, GPUs: gpus}, nil
+}
+
+const defaultRollupSeconds = 300
+
+// RollupStat summarizes one metric over a window.
+type RollupStat struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+type GPURollup struct {
+	Index             int        `json:"index"`
+	UUID              string     `json:"uuid"`
+	Name              string     `json:"name"`
+	Samples           int        `json:"samples"`
+	TemperatureC      RollupStat `json:"temperature_c"`
+	GPUUtilizationPct RollupStat `json:"gpu_utilization_pct"`
+	PowerDrawW        RollupStat `json:"power_draw_w"`
+	MemoryUsedMiB     RollupStat `json:"memory_used_mib"`
+}
+
+// Rollup is the response of /api/gpus/rollup. CoveredSeconds is the span
+// the samples actually cover, which is shorter than RequestedSeconds when
+// the history doesn't reach back that far.
+type Rollup struct {
+	Timestamp        string      `json:"timestamp"`
+	RequestedSeconds int         `json:"requested_seconds"`
+	CoveredSeconds   float64     `json:"covered_seconds"`
+	GPUs             []GPURollup `json:"gpus"`
+}
+
+// rollupGPUs aggregates history samples per GPU UUID, ordered by index.
+// secondsParam comes straight from the query string.
+func rollupGPUs(history func(since time.Time) []historySample, secondsParam string) (*Rollup, error) {
+	seconds := defaultRollupSeconds
+	if secondsParam != "" {
+		n, err := strconv.Atoi(secondsParam)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid seconds %q: want a positive integer", secondsParam)
+		}
+		seconds = n
+	}
+	now := time.Now()
+	samples := history(now.Add(-time.Duration(seconds) * time.Second))
+
+	type acc struct {
+		rollup                 GPURollup
+		temp, util, power, mem []float64
+	}
+	byUUID := make(map[string]*acc)
+	for _, s := range samples {
+		for _, g := range s.Metrics.GPUs {
+			a := byUUID[g.UUID]
+			if a == nil {
+				a = &acc{}
+				byUUID[g.UUID] = a
+			}
+			a.rollup.Index, a.rollup.UUID, a.rollup.Name = g.Index, g.UUID, g.Name
+			a.temp = append(a.temp, float64(g.TemperatureC))
+			a.util = append(a.util, float64(g.GPUUtilizationPct))
+			a.power = append(a.power, g.PowerDrawW)
+			a.mem = append(a.mem, float64(g.MemoryUsedMiB))
+		}
+	}
+
+	r := &Rollup{
+		Timestamp:        now.UTC().Format(time.RFC3339),
+		RequestedSeconds: seconds,
+		GPUs:             []GPURollup{},
+	}
+	if len(samples) > 0 {
+		r.CoveredSeconds = math.Round(now.Sub(samples[0].Time).Seconds())
+	}
+	for _, a := range byUUID {
+		a.rollup.Samples = len(a.temp)
+		a.rollup.TemperatureC = rollupStat(a.temp)
+		a.rollup.GPUUtilizationPct = rollupStat(a.util)
+		a.rollup.PowerDrawW = rollupStat(a.power)
+		a.rollup.MemoryUsedMiB = rollupStat(a.mem)
+		r.GPUs = append(r.GPUs, a.rollup)
+	}
+	slices.SortFunc(r.GPUs, func(a, b GPURollup) int { return a.Index - b.Index })
+	return r, nil
+}
+
+// HistoryPoint is one GPU's chartable values at one sample. Values the
+// GPU didn't report (the *_available flags of GPUInfo, or HasFan) are null
+// rather than 0, so charts show a gap instead of a drop.
+type HistoryPoint struct {
+	Time              time.Time `json:"time"`
+	TemperatureC      *int      `json:"temperature_c"`
+	FanSpeedPct       *int      `json:"fan_speed_pct"`
+	PowerDrawW        *float64  `json:"power_draw_w"`
+	MemoryUsedMiB     int       `json:"memory_used_mib"`
+	MemoryFreeMiB     int       `json:"memory_free_mib"`
+	GPUUtilizationPct *int      `json:"gpu_utilization_pct"`
+	MemUtilizationPct *int      `json:"mem_utilization_pct"`
+	UtilPerWatt       *float64  `json:"util_per_watt"`
+}
+
+// ifAvailable returns &v, or nil if the value wasn't reported.
+func ifAvailable[T any](v T, available bool) *T {
+	if !available {
+		return nil
+	}
+	return &v
+}
+
+// GPUSeries is the history of one GPU, oldest point first. A GPU is
+// identified by UUID; Index and Name are as of its latest point.
+type GPUSeries struct {
+	Index  int            `json:"index"`
+	UUID   string         `json:"uuid"`
+	Name   string         `json:"name"`
+	Points []HistoryPoint `json:"points"`
+}
+
+// GPUHistory is the response of /api/gpus/history: one series per GPU
+// UUID, ordered by index, over [Since, Until].
+type GPUHistory struct {
+	Timestamp   string      `json:"timestamp"`
+	Since       time.Time   `json:"since"`
+	Until       time.Time   `json:"until"`
+	StepSeconds float64     `json:"step_seconds"` // 0: every sample
+	GPUs        []GPUSeries `json:"gpus"`
+}
+
+// historyDefaultPoints is about how many points per GPU /api/gpus/history
+// returns when no step is given. Every sample of the default two hour
+// retention would be 7,200 per GPU.
+const historyDefaultPoints = 300
+
+// historyRange parses the since, until and step query parameters of
+// /api/gpus/history. since and until are RFC 3339 times or durations
+// before now ("15m"); since defaults to oldest, the start of the
+// retention window, and until to now. step is a duration, 0 for every
+// sample; unset, it is the whole second that gives historyDefaultPoints
+// over the range.
+func historyRange(since, until, step string, now, oldest time.Time) (from, to time.Time, every time.Duration, err error) {
+	parseTime := func(name, v string, def time.Time) (time.Time, error) {
+		if v == "" {
+			return def, nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return now.Add(-d), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid %s %q: want an RFC 3339 time or a duration ago such as 15m", name, v)
+	}
+	if from, err = parseTime("since", since, oldest); err != nil {
+		return
+	}
+	if to, err = parseTime("until", until, now); err != nil {
+		return
+	}
+	if to.Before(from) {
+		err = fmt.Errorf("until %s is before since %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+		return
+	}
+	if step == "" {
+		every = (to.Sub(from) / historyDefaultPoints).Truncate(time.Second)
+		return
+	}
+	if every, err = time.ParseDuration(step); err != nil || every < 0 {
+		err = fmt.Errorf("invalid step %q: want a duration such as 10s", step)
+	}
+	return
+}
+
+// historySeries turns samples, oldest first, into per-GPU series, keeping
+// only the first sample of each step.
+func historySeries(samples []historySample, step time.Duration) []GPUSeries {
+	series := []GPUSeries{}
+	byUUID := make(map[string]int) // position in series
+	var next time.Time
+	for _, s := range samples {
+		if s.Time.Before(next) {
+			continue
+		}
+		next = s.Time.Add(step)
+		for _, g := range s.Metrics.GPUs {
+			pos, ok := byUUID[g.UUID]
+			if !ok {
+				pos = len(series)
+				byUUID[g.UUID] = pos
+				series = append(series, GPUSeries{UUID: g.UUID, Points: []HistoryPoint{}})
+			}
+			series[pos].Index, series[pos].Name = g.Index, g.Name
+			series[pos].Points = append(series[pos].Points, HistoryPoint{
+				Time:              s.Time,
+				TemperatureC:      ifAvailable(g.TemperatureC, g.TemperatureAvailable),
+				FanSpeedPct:       ifAvailable(g.FanSpeedPct, g.HasFan),
+				PowerDrawW:        ifAvailable(g.PowerDrawW, g.PowerDrawAvailable),
+				MemoryUsedMiB:     g.MemoryUsedMiB,
+				MemoryFreeMiB:     g.MemoryFreeMiB,
+				GPUUtilizationPct: ifAvailable(g.GPUUtilizationPct, g.GPUUtilizationAvailable),
+				MemUtilizationPct: ifAvailable(g.MemUtilizationPct, g.MemUtilizationAvailable),
+				UtilPerWatt:       ifAvailable(g.UtilPerWatt, g.PowerDrawAvailable && g.GPUUtilizationAvailable),
+			})
+		}
+	}
+	slices.SortFunc(series, func(a, b GPUSeries) int { return a.Index - b.Index })
+	return series
+}
+
+func rollupStat(values []float64) RollupStat {
+	s := RollupStat{Min: values[0], Max: values[0]}
+	var sum float64
+	for _, v := range values {
+		s.Min = min(s.Min, v)
+		s.Max = max(s.Max, v)
+		sum += v
+	}
+	s.Avg = round2(sum / float64(len(values)))
+	return s
+}
+
+// GPUModel summarizes all GPUs of one model (same Name).
+type GPUModel struct {
+	Name                 string  `json:"name"`
+	Count                int     `json:"count"`
+	Indexes              []int   `json:"indexes"`
+	MemoryTotalMiB       int     `json:"memory_total_mib"`
+	MemoryUsedMiB        int     `json:"memory_used_mib"`
+	AvgGPUUtilizationPct float64 `json:"avg_gpu_utilization_pct"`
+	AvgTemperatureC      float64 `json:"avg_temperature_c"`
+}
+
+type GPUModels struct {
+	Timestamp string     `json:"timestamp"`
+	Models    []GPUModel `json:"models"`
+}
+
+// gpuModels groups the GPUs in metrics by name, most numerous first.
+func gpuModels(metrics *GPUMetrics) *GPUModels {
+	byName := make(map[string]*GPUModel)
+	util, temp := make(map[string]int), make(map[string]int)
+	for _, g := range metrics.GPUs {
+		m := byName[g.Name]
+		if m == nil {
+			m = &GPUModel{Name: g.Name, Indexes: []int{}}
+			byName[g.Name] = m
+		}
+		m.Count++
+		m.Indexes = append(m.Indexes, g.Index)
+		m.MemoryTotalMiB += g.MemoryTotalMiB
+		m.MemoryUsedMiB += g.MemoryUsedMiB
+		util[g.Name] += g.GPUUtilizationPct
+		temp[g.Name] += g.TemperatureC
+	}
+
+	out := &GPUModels{Timestamp: metrics.Timestamp, Models: []GPUModel{}}
+	for name, m := range byName {
+		m.AvgGPUUtilizationPct = round2(float64(util[name]) / float64(m.Count))
+		m.AvgTemperatureC = round2(float64(temp[name]) / float64(m.Count))
+		out.Models = append(out.Models, *m)
+	}
+	slices.SortFunc(out.Models, func(a, b GPUModel) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return out
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryRangeStep(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	oldest := now.Add(-2 * time.Hour)
+	for _, tc := range []struct {
+		since, step string
+		want        time.Duration
+	}{
+		{"", "", 24 * time.Second},
+		{"15m", "", 3 * time.Second},
+		{"2m", "", 0}, // under a second per point: every sample
+		{"", "0", 0},
+		{"", "10s", 10 * time.Second},
+	} {
+		_, _, step, err := historyRange(tc.since, "", tc.step, now, oldest)
+		if err != nil || step != tc.want {
+			t.Errorf("since=%q step=%q: got %s, %v; want %s", tc.since, tc.step, step, err, tc.want)
+		}
+	}
+}
+
+func TestHistorySeriesUnavailable(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	samples := []historySample{{Time: at, Metrics: &GPUMetrics{GPUs: []GPUInfo{{
+		UUID:                 "GPU-a",
+		TemperatureC:         50,
+		TemperatureAvailable: true,
+		PowerDrawW:           0,
+		GPUUtilizationPct:    0,
+	}}}}}
+	series := historySeries(samples, 0)
+	if len(series) != 1 || len(series[0].Points) != 1 {
+		t.Fatalf("got %+v, want one point", series)
+	}
+	p := series[0].Points[0]
+	if p.TemperatureC == nil || *p.TemperatureC != 50 {
+		t.Errorf("temperature_c = %v, want 50", p.TemperatureC)
+	}
+	if p.FanSpeedPct != nil || p.PowerDrawW != nil || p.GPUUtilizationPct != nil || p.MemUtilizationPct != nil || p.UtilPerWatt != nil {
+		t.Errorf("unreported values aren't null: %+v", p)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsDelta is pushed in delta mode (/ws?mode=delta). The first message is a
+// full snapshot; later messages carry only GPUs that changed since the
+// previous message and Ollama stats when they changed. Seq increases by one
+// per message, so a client that sees a gap should reconnect to resync.
+type wsDelta struct {
+	SchemaVersion int          `json:"schema_version"`
+	Seq           uint64       `json:"seq"`
+	Full          bool         `json:"full"`
+	GPU           *GPUMetrics  `json:"gpu,omitempty"`
+	ChangedGPUs   []GPUInfo    `json:"changed_gpus,omitempty"`
+	RemovedGPUs   []string     `json:"removed_gpus,omitempty"`
+	Ollama        *OllamaStats `json:"ollama,omitempty"`
+}
+
+// wsClientMessage is what clients may send. {"subscribe":["gpu"]} limits
+// the connection to the listed streams; an empty list means all of them.
+type wsClientMessage struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+// wsSubscription is the set of streams a connection receives.
+type wsSubscription struct {
+	gpu, ollama bool
+}
+
+func parseSubscription(streams []string) wsSubscription {
+	if len(streams) == 0 {
+		return wsSubscription{gpu: true, ollama: true}
+	}
+	var sub wsSubscription
+	for _, name := range streams {
+		switch name {
+		case "gpu":
+			sub.gpu = true
+		case "ollama":
+			sub.ollama = true
+		}
+	}
+	return sub
+}
+
+// wsConnections counts open /ws connections, for /api/self.
+var wsConnections atomic.Int64
+
+func serveWS(gpuMon *GPUMonitor, ollamaMon *OllamaMonitor, cfg *Config) http.HandlerFunc {
+	// A client that can't take a message within writeTimeout is dropped,
+	// so a stalled connection can't hold its goroutine forever.
+	writeTimeout := cfg.WSWriteTimeout
+	token := cfg.WSToken
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		delta := r.URL.Query().Get("mode") == "delta"
+		opts, err := parseOutputOptions(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_option", err.Error())
+			return
+		}
+
+		var header http.Header
+		if token != "" {
+			protocol, ok := wsToken(r, token)
+			if !ok {
+				writeJSONError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid token")
+				return
+			}
+			if protocol != "" {
+				// Browsers fail the handshake unless the server picks one
+				// of the offered subprotocols.
+				header = http.Header{"Sec-Websocket-Protocol": {protocol}}
+			}
+		}
+
+		conn, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			log.Println("ws upgrade:", err)
+			return
+		}
+		defer conn.Close()
+		wsConnections.Add(1)
+		defer wsConnections.Add(-1)
+
+		// The reader handles subscription messages and control frames, and
+		// notices when the client goes away.
+		subCh := make(chan wsSubscription, 1)
+		done := make(chan struct{})
+		conn.SetReadLimit(4096)
+		go func() {
+			defer close(done)
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				var msg wsClientMessage
+				if err := json.Unmarshal(data, &msg); err != nil {
+					continue
+				}
+				select {
+				case <-subCh:
+				default:
+				}
+				subCh <- parseSubscription(msg.Subscribe)
+			}
+		}()
+
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+
+		sub := parseSubscription(nil)
+		var state deltaState
+		// send writes the current snapshot; false means the connection is
+		// done for.
+		send := func() bool {
+			var gpu *GPUMetrics
+			var ollama *OllamaStats
+			if sub.gpu {
+				gpu = gpuMon.Latest()
+			}
+			if sub.ollama {
+				ollama = ollamaMon.Latest()
+			}
+			var msg any = wsPayload{SchemaVersion: schemaVersion, GPU: gpu, Ollama: ollama}
+			if delta {
+				d := state.next(gpu, ollama)
+				if d == nil {
+					return true
+				}
+				msg = d
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := writeWS(conn, msg, opts); err != nil {
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					log.Printf("ws: dropping %s: write timed out after %s", r.RemoteAddr, writeTimeout)
+				}
+				return false
+			}
+			return true
+		}
+
+		// Send what we have right away rather than after the first tick,
+		// so a (re)connecting client paints immediately.
+		if gpuMon.Latest() != nil || ollamaMon.Latest() != nil {
+			if !send() {
+				return
+			}
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case sub = <-subCh:
+				continue
+			case <-ticker.C:
+			}
+			if !send() {
+				return
+			}
+		}
+	}
+}
+
+// wsToken checks a connection request for WS_TOKEN, either as ?token= or,
+// since browsers can't set headers on a WebSocket, as one of the offered
+// subprotocols. protocol is the subprotocol that matched, if any.
+func wsToken(r *http.Request, token string) (protocol string, ok bool) {
+	matches := func(s string) bool {
+		return subtle.ConstantTimeCompare([]byte(s), []byte(token)) == 1
+	}
+	if matches(r.URL.Query().Get("token")) {
+		return "", true
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if matches(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// writeWS sends msg as JSON, rendered with the output options of the
+// connection's URL like the REST responses.
+func writeWS(conn *websocket.Conn, msg any, opts outputOptions) error {
+	if opts.empty() {
+		return conn.WriteJSON(msg)
+	}
+	out, err := render(msg, opts)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, out)
+}
+
+// deltaState tracks what a single delta-mode connection has already seen.
+type deltaState struct {
+	seq    uint64
+	gpus   map[string]GPUInfo
+	ollama *OllamaStats
+}
+
+// next returns the message to send for the given snapshots, or nil if
+// nothing changed.
+func (s *deltaState) next(gpu *GPUMetrics, ollama *OllamaStats) *wsDelta {
+	if gpu == nil && ollama == nil {
+		return nil
+	}
+
+	d := &wsDelta{SchemaVersion: schemaVersion}
+	if s.gpus == nil {
+		d.Full = true
+		d.GPU = gpu
+		d.Ollama = ollama
+	} else {
+		if gpu != nil {
+			seen := make(map[string]bool, len(gpu.GPUs))
+			for _, g := range gpu.GPUs {
+				seen[g.UUID] = true
+				if prev, ok := s.gpus[g.UUID]; !ok || !reflect.DeepEqual(prev, g) {
+					d.ChangedGPUs = append(d.ChangedGPUs, g)
+				}
+			}
+			for uuid := range s.gpus {
+				if !seen[uuid] {
+					d.RemovedGPUs = append(d.RemovedGPUs, uuid)
+				}
+			}
+		}
+		if !ollamaStatsEqual(s.ollama, ollama) {
+			d.Ollama = ollama
+		}
+		if len(d.ChangedGPUs) == 0 && len(d.RemovedGPUs) == 0 && d.Ollama == nil {
+			return nil
+		}
+	}
+
+	if gpu != nil {
+		s.gpus = make(map[string]GPUInfo, len(gpu.GPUs))
+		for _, g := range gpu.GPUs {
+			s.gpus[g.UUID] = g
+		}
+	} else if s.gpus == nil {
+		s.gpus = map[string]GPUInfo{}
+	}
+	s.ollama = ollama
+	s.seq++
+	d.Seq = s.seq
+	return d
+}
+
+// ollamaStatsEqual compares two snapshots ignoring their timestamps and
+// fetch durations.
+func ollamaStatsEqual(a, b *OllamaStats) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	x, y := *a, *b
+	x.Timestamp, y.Timestamp = "", ""
+	x.FetchDurationMs, y.FetchDurationMs = 0, 0
+	return reflect.DeepEqual(x, y)
+}